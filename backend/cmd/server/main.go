@@ -6,23 +6,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/auth"
 	"github.com/ilhammramadhan/gabble/internal/config"
 	"github.com/ilhammramadhan/gabble/internal/database"
 	"github.com/ilhammramadhan/gabble/internal/handlers"
+	"github.com/ilhammramadhan/gabble/internal/metrics"
 	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/ratelimit"
 	"github.com/ilhammramadhan/gabble/internal/websocket"
 )
 
 func main() {
 	cfg := config.Load()
 
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	if cfg.DatabaseURL == "" {
 		log.Fatal("DATABASE_URL environment variable is not set")
 	}
@@ -37,67 +44,207 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
-	hub := websocket.NewHub(db)
+	if err := db.BootstrapAdmins(context.Background(), cfg.AdminUsers); err != nil {
+		log.Fatalf("Failed to bootstrap admins: %v", err)
+	}
+
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	authn := auth.NewAuthenticator(db, keys, cfg.AuthCacheTTL)
+
+	origins, err := cfg.OriginPolicy()
+	if err != nil {
+		log.Fatalf("Invalid allowed origins: %v", err)
+	}
+
+	proxies, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	limits, err := cfg.RateLimits()
+	if err != nil {
+		log.Fatalf("Invalid rate limits: %v", err)
+	}
+
+	auditLog := audit.NewLogger(db)
+
+	hub := websocket.NewHub(db, auditLog, websocket.Options{
+		SlowConsumerPolicy:    websocket.SlowConsumerPolicy(cfg.WSSlowConsumerPolicy),
+		MaxMessageSize:        int64(cfg.WSMaxMessageSize),
+		SendBufferSize:        cfg.WSSendBufferSize,
+		WriteWait:             cfg.WSWriteWait,
+		PongWait:              cfg.WSPongWait,
+		CompressionThreshold:  cfg.WSCompressionThreshold,
+		MaxConnections:        cfg.WSMaxConnections,
+		MaxConnectionsPerUser: cfg.WSMaxConnectionsPerUser,
+		MaxConnectionsPerIP:   cfg.WSMaxConnectionsPerIP,
+		EvictOldest:           cfg.WSEvictOldest,
+		EventLimits: map[websocket.EventType]ratelimit.Limit{
+			websocket.EventSendMessage: limits.WSMessages,
+			websocket.EventTyping:      limits.WSTyping,
+		},
+		DefaultEventLimit: limits.WSEvents,
+		AbuseLimit:        limits.WSAbuse,
+
+		AutomodMuteDuration: cfg.AutomodMuteDuration,
+	})
 	go hub.Run()
 
-	authHandler := handlers.NewAuthHandler(db, cfg)
-	roomHandler := handlers.NewRoomHandler(db)
-	wsHandler := handlers.NewWebSocketHandler(hub, db, cfg)
+	metrics.NewGaugeFunc("gabble_ws_connections", "Open WebSocket connections.", func() float64 {
+		return float64(hub.ConnectionStats().Total)
+	})
+
+	authHandler := handlers.NewAuthHandler(db, cfg, keys, authn, hub, auditLog)
+	roomHandler := handlers.NewRoomHandler(db, hub, auditLog)
+	tokenHandler := handlers.NewTokenHandler(db, auditLog)
+	adminHandler := handlers.NewAdminHandler(db, hub, authn, auditLog)
+	presenceHandler := handlers.NewPresenceHandler(db, hub)
+	wsHandler := handlers.NewWebSocketHandler(hub, db, cfg, authn, origins)
+	eventsHandler := handlers.NewEventsHandler(hub, authn)
+	roomSettingsHandler := handlers.NewRoomSettingsHandler(db, hub, auditLog)
+	automodHandler := handlers.NewAutomodHandler(db, hub, auditLog)
+	reportHandler := handlers.NewReportHandler(db, hub, authn, auditLog)
+	blockHandler := handlers.NewBlockHandler(db, hub)
+	pinHandler := handlers.NewPinHandler(db, hub, cfg, auditLog)
+	pollHandler := handlers.NewPollHandler(hub)
 
 	r := chi.NewRouter()
 
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
 	r.Use(chimw.RequestID)
-	r.Use(chimw.RealIP)
-	r.Use(chimw.Timeout(60 * time.Second))
+	r.Use(middleware.RealIP(proxies))
+	r.Use(func(next http.Handler) http.Handler {
+		timeout := chimw.Timeout(60 * time.Second)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Event streams stay open far longer than any request should,
+			// and audit exports run as long as the log takes to write.
+			if r.URL.Path == "/events" || r.URL.Path == "/api/admin/audit/export" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timeout.ServeHTTP(w, r)
+		})
+	})
 
 	r.Use(cors.Handler(cors.Options{
-		AllowOriginFunc: func(r *http.Request, origin string) bool {
-			// Allow localhost for development
-			if strings.HasPrefix(origin, "http://localhost") {
-				return true
-			}
-			// Allow all Vercel preview URLs
-			if strings.HasSuffix(origin, ".vercel.app") {
-				return true
-			}
-			// Allow configured frontend URL
-			if origin == cfg.FrontendURL {
-				return true
-			}
-			return false
-		},
+		AllowOriginFunc:  middleware.OriginChecker(origins, "cors"),
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	// Ahead of every route, /auth/logout included, so no write made with the
+	// session cookie escapes the origin check.
+	r.Use(middleware.CSRFProtect(origins))
+
+	r.Use(middleware.RateLimit(ratelimit.New("http_ip", limits.IP), middleware.ClientIP))
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
 
-	r.Get("/auth/github", authHandler.GithubLogin)
-	r.Get("/auth/github/callback", authHandler.GithubCallback)
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
+
+	r.Get("/auth/providers", authHandler.GetProviders)
+	r.Post("/auth/logout", authHandler.Logout)
+
+	if cfg.GithubAuthEnabled() {
+		r.Get("/auth/github", authHandler.GithubLogin)
+		r.Get("/auth/github/callback", authHandler.GithubCallback)
+	}
+
+	if cfg.LocalAuthEnabled() {
+		r.Post("/auth/register", authHandler.Register)
+		r.Post("/auth/login", authHandler.Login)
+		r.Post("/auth/password-reset", authHandler.ResetPassword)
+	}
 
 	r.Route("/api", func(r chi.Router) {
 		r.Get("/rooms", roomHandler.GetRooms)
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware(db, cfg.JWTSecret))
+			r.Use(middleware.AuthMiddleware(authn))
+			r.Use(middleware.RateLimit(ratelimit.New("http_user", limits.User), middleware.UserKey))
 
 			r.Get("/auth/me", authHandler.GetCurrentUser)
+			if cfg.LocalAuthEnabled() {
+				r.Put("/auth/password", authHandler.ChangePassword)
+			}
+
+			r.Get("/tokens", tokenHandler.GetTokens)
+			r.Post("/tokens", tokenHandler.CreateToken)
+			r.Delete("/tokens/{id}", tokenHandler.DeleteToken)
 
-			r.Post("/rooms", roomHandler.CreateRoom)
+			r.With(middleware.RateLimit(ratelimit.New("room_create", limits.RoomCreate), middleware.UserKey)).
+				Post("/rooms", roomHandler.CreateRoom)
 			r.Get("/rooms/{id}", roomHandler.GetRoom)
 			r.Delete("/rooms/{id}", roomHandler.DeleteRoom)
 			r.Get("/rooms/{id}/messages", roomHandler.GetMessages)
+			r.Post("/rooms/{id}/messages", eventsHandler.SendMessage)
+			r.Get("/rooms/{id}/settings", roomSettingsHandler.GetSettings)
+			r.Put("/rooms/{id}/settings", roomSettingsHandler.UpdateSettings)
+			r.Get("/rooms/{id}/automod/rules", automodHandler.GetRules)
+			r.Post("/rooms/{id}/automod/rules", automodHandler.CreateRule)
+			r.Delete("/rooms/{id}/automod/rules/{ruleID}", automodHandler.DeleteRule)
+			r.Get("/rooms/{id}/automod/hits", automodHandler.GetHits)
+			r.Get("/rooms/{id}/reports", reportHandler.GetReports)
+			r.Put("/rooms/{id}/reports/{reportID}", reportHandler.ResolveReport)
+			r.Get("/rooms/{id}/pins", pinHandler.GetPins)
+			r.Post("/rooms/{id}/pins", pinHandler.PinMessage)
+			r.Delete("/rooms/{id}/pins/{messageID}", pinHandler.UnpinMessage)
+			r.Post("/messages/{id}/reports", reportHandler.ReportMessage)
+
+			r.Get("/users/{id}/presence", presenceHandler.GetPresence)
+
+			r.Get("/blocks", blockHandler.GetBlocks)
+			r.Post("/blocks", blockHandler.BlockUser)
+			r.Delete("/blocks/{id}", blockHandler.UnblockUser)
+
+			r.Post("/poll", pollHandler.CreateSession)
+			r.Get("/poll", pollHandler.Poll)
+			r.Post("/poll/events", pollHandler.SendEvent)
+			r.Delete("/poll", pollHandler.DeleteSession)
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(middleware.RequireAdmin)
+
+				r.Get("/users", adminHandler.GetUsers)
+				r.Put("/users/{id}/status", adminHandler.UpdateUserStatus)
+				r.Put("/users/{id}/admin", adminHandler.UpdateUserAdmin)
+
+				r.Delete("/rooms/{id}", adminHandler.DeleteRoom)
+				r.Post("/rooms/{id}/transfer", adminHandler.TransferRoom)
+
+				r.Get("/connections", adminHandler.GetConnections)
+				r.Get("/metrics", metrics.Handler)
+				r.Post("/announcements", adminHandler.CreateAnnouncement)
+
+				r.Get("/audit", adminHandler.GetAuditLog)
+				r.Get("/audit/export", adminHandler.ExportAuditLog)
+
+				r.Get("/automod/rules", automodHandler.GetRules)
+				r.Post("/automod/rules", automodHandler.CreateRule)
+				r.Delete("/automod/rules/{ruleID}", automodHandler.DeleteRule)
+				r.Get("/automod/hits", automodHandler.GetHits)
+
+				r.Get("/reports", reportHandler.GetReports)
+				r.Put("/reports/{reportID}", reportHandler.ResolveReport)
+
+				if cfg.LocalAuthEnabled() {
+					r.Post("/users/{id}/password-reset", authHandler.CreatePasswordReset)
+				}
+			})
 		})
 	})
 
 	r.Get("/ws", wsHandler.HandleWebSocket)
+	r.Get("/events", eventsHandler.Stream)
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -123,8 +270,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Drain the hub first: server.Shutdown does not touch hijacked WebSocket
+	// connections and waits for SSE streams and long polls, which only end
+	// once the hub closes their clients.
+	if err := hub.Shutdown(ctx); err != nil {
+		log.Printf("Realtime connections did not drain: %v", err)
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server did not shut down cleanly: %v", err)
 	}
 
 	log.Println("Server exited")
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+const (
+	ActionLogin              = "auth.login"
+	ActionLoginFailed        = "auth.login_failed"
+	ActionRegister           = "auth.register"
+	ActionPasswordChange     = "auth.password_change"
+	ActionPasswordReset      = "auth.password_reset"
+	ActionTokenIssue         = "token.issue"
+	ActionTokenRevoke        = "token.revoke"
+	ActionRoomCreate         = "room.create"
+	ActionRoomDelete         = "room.delete"
+	ActionRoomSettingsUpdate = "room.settings_update"
+	ActionUserStatus         = "admin.user_status"
+	ActionUserAdmin          = "admin.user_admin"
+	ActionPasswordResetIssue = "admin.password_reset_issue"
+	ActionAdminRoomDelete    = "admin.room_delete"
+	ActionAdminRoomTransfer  = "admin.room_transfer"
+	ActionAnnouncement       = "admin.announcement"
+	ActionAutomodRuleCreate  = "automod.rule_create"
+	ActionAutomodRuleDelete  = "automod.rule_delete"
+	ActionReportCreate       = "report.create"
+	ActionReportResolve      = "report.resolve"
+	ActionMessageDelete      = "message.delete"
+	ActionUserMute           = "room.mute"
+	ActionMessagePin         = "message.pin"
+	ActionMessageUnpin       = "message.unpin"
+)
+
+const (
+	TargetUser     = "user"
+	TargetRoom     = "room"
+	TargetAPIToken = "api_token"
+	TargetRule     = "automod_rule"
+	TargetReport   = "report"
+	TargetMessage  = "message"
+)
+
+type Logger struct {
+	DB *database.DB
+}
+
+func NewLogger(db *database.DB) *Logger {
+	return &Logger{DB: db}
+}
+
+// Event describes what happened; Record fills in who did it and from where.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	// Actor overrides the authenticated user, for events such as logins
+	// where the request is not yet authenticated.
+	Actor    *models.User
+	Metadata map[string]interface{}
+}
+
+// Record appends an entry for an event caused by an HTTP request, taking
+// the actor from the request context, the client IP as rewritten by
+// middleware.RealIP and the chimw.RequestID correlation ID. Failures are
+// logged rather than returned so auditing never fails the request it
+// describes.
+func (l *Logger) Record(r *http.Request, event Event) {
+	actor := event.Actor
+	if actor == nil {
+		actor, _ = r.Context().Value(middleware.UserContextKey).(*models.User)
+	}
+
+	entry := &models.AuditEntry{
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         middleware.ClientIP(r),
+		RequestID:  chimw.GetReqID(r.Context()),
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.ActorName = actor.Username
+	}
+
+	l.write(r.Context(), entry, event.Metadata)
+}
+
+// RecordSystem appends an entry for an event that did not come from an
+// HTTP request, such as an action taken over a WebSocket connection. A nil
+// actor records the server itself, as for automatic moderation.
+func (l *Logger) RecordSystem(ctx context.Context, actor *models.User, event Event) {
+	entry := &models.AuditEntry{
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.ActorName = actor.Username
+	}
+
+	l.write(ctx, entry, event.Metadata)
+}
+
+func (l *Logger) write(ctx context.Context, entry *models.AuditEntry, metadata map[string]interface{}) {
+	if len(metadata) > 0 {
+		data, err := json.Marshal(metadata)
+		if err == nil {
+			entry.Metadata = data
+		}
+	}
+
+	// Detach from request cancellation so a client hanging up does not drop
+	// the entry.
+	if err := l.DB.CreateAuditEntry(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("error writing audit entry %s: %v", entry.Action, err)
+	}
+}
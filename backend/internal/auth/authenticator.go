@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+const (
+	CookieName       = "gabble_token"
+	APITokenPrefix   = "gbl_"
+	ResetTokenPrefix = "gblr_"
+)
+
+const (
+	MethodJWT      = "jwt"
+	MethodAPIToken = "api_token"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	User *models.User
+	// Method is how the caller authenticated: MethodJWT or MethodAPIToken.
+	Method string
+	// TokenID is the API token ID when Method is MethodAPIToken.
+	TokenID string
+}
+
+// Authenticator verifies credentials presented on HTTP and WebSocket
+// requests and resolves them to a user. It is the only place tokens are
+// parsed.
+type Authenticator struct {
+	DB    *database.DB
+	Keys  *KeySet
+	users *userCache
+}
+
+func NewAuthenticator(db *database.DB, keys *KeySet, cacheTTL time.Duration) *Authenticator {
+	return &Authenticator{
+		DB:    db,
+		Keys:  keys,
+		users: newUserCache(cacheTTL),
+	}
+}
+
+// Authenticate reads credentials from, in order, the Authorization header,
+// the token query parameter (when allowQuery is set, for WebSocket upgrades
+// where browsers cannot send headers) and the session cookie.
+func (a *Authenticator) Authenticate(r *http.Request, allowQuery bool) (*Principal, error) {
+	credential, err := credentialFromRequest(r, allowQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(credential, APITokenPrefix) {
+		return a.authenticateAPIToken(r.Context(), credential)
+	}
+	return a.authenticateJWT(r.Context(), credential)
+}
+
+func credentialFromRequest(r *http.Request, allowQuery bool) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, credential, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || credential == "" {
+			return "", ErrMalformedCredentials
+		}
+		return credential, nil
+	}
+
+	if allowQuery {
+		if token := r.URL.Query().Get("token"); token != "" {
+			return token, nil
+		}
+	}
+
+	if cookie, err := r.Cookie(CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	return "", ErrNoCredentials
+}
+
+func (a *Authenticator) authenticateJWT(ctx context.Context, tokenString string) (*Principal, error) {
+	token, err := a.Keys.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.ResolveUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens from before the tv claim existed carry version 0.
+	version, _ := claims["tv"].(float64)
+	if int(version) != user.TokenVersion {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{User: user, Method: MethodJWT}, nil
+}
+
+func (a *Authenticator) authenticateAPIToken(ctx context.Context, token string) (*Principal, error) {
+	tokenID, userID, err := a.DB.UseAPIToken(ctx, HashAPIToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.ResolveUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{User: user, Method: MethodAPIToken, TokenID: tokenID}, nil
+}
+
+// ResolveUser loads a user through the short-lived cache.
+func (a *Authenticator) ResolveUser(ctx context.Context, userID string) (*models.User, error) {
+	if user, ok := a.users.get(userID); ok {
+		return user, nil
+	}
+
+	user, err := a.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Status != database.UserStatusActive {
+		return nil, ErrAccountDisabled
+	}
+	a.users.set(user)
+	return user, nil
+}
+
+// Forget drops a user from the cache so changes to the account take effect
+// on the next request rather than after the cache TTL.
+func (a *Authenticator) Forget(userID string) {
+	a.users.delete(userID)
+}
+
+// NewAPIToken generates a random API token, returning the plaintext shown to
+// the user once and the hash that is stored.
+func NewAPIToken() (token, hash string, err error) {
+	return newOpaqueToken(APITokenPrefix)
+}
+
+// NewResetToken generates a single-use password reset token.
+func NewResetToken() (token, hash string, err error) {
+	return newOpaqueToken(ResetTokenPrefix)
+}
+
+func newOpaqueToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + hex.EncodeToString(b)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken hashes an opaque token for storage and lookup.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	ErrNoCredentials        = errors.New("authentication required")
+	ErrMalformedCredentials = errors.New("malformed authorization header")
+	ErrInvalidToken         = errors.New("invalid or expired token")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAccountDisabled      = errors.New("account is disabled")
+)
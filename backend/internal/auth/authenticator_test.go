@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilhammramadhan/gabble/internal/config"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func TestAuthenticateJWTTokenVersion(t *testing.T) {
+	ks, err := LoadKeySet(&config.Config{JWTAlgorithm: "HS256", JWTSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(nil, ks, time.Minute)
+	a.users.set(&models.User{ID: "u1", Status: database.UserStatusActive, TokenVersion: 1})
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["user_id"] = "u1"
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, err := ks.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	if _, err := a.authenticateJWT(context.Background(), sign(jwt.MapClaims{"tv": 1})); err != nil {
+		t.Errorf("current version rejected: %v", err)
+	}
+	if _, err := a.authenticateJWT(context.Background(), sign(jwt.MapClaims{"tv": 0})); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old version: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := a.authenticateJWT(context.Background(), sign(jwt.MapClaims{})); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token without tv: err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+type cachedUser struct {
+	user      *models.User
+	expiresAt time.Time
+}
+
+// userCache keeps recently resolved users for a short TTL so every REST call
+// and socket upgrade does not hit the users table.
+type userCache struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	users map[string]cachedUser
+}
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{ttl: ttl, users: make(map[string]cachedUser)}
+}
+
+func (c *userCache) get(id string) (*models.User, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.users[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.users, id)
+		return nil, false
+	}
+	return entry.user, true
+}
+
+func (c *userCache) set(user *models.User) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	// Sweep expired entries opportunistically so the map cannot grow
+	// without bound.
+	if len(c.users) > 1024 {
+		for id, entry := range c.users {
+			if now.After(entry.expiresAt) {
+				delete(c.users, id)
+			}
+		}
+	}
+	c.users[user.ID] = cachedUser{user: user, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *userCache) delete(id string) {
+	c.mu.Lock()
+	delete(c.users, id)
+	c.mu.Unlock()
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// WriteError writes an authentication failure as JSON so REST and
+// WebSocket upgrade requests fail the same way.
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrAccountDisabled) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "account_disabled", Message: err.Error()})
+		return
+	}
+
+	code := "unauthorized"
+	switch {
+	case errors.Is(err, ErrMalformedCredentials):
+		code = "invalid_request"
+	case errors.Is(err, ErrInvalidToken):
+		code = "invalid_token"
+	case errors.Is(err, ErrUserNotFound):
+		code = "user_not_found"
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: code, Message: err.Error()})
+}
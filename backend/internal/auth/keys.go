@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilhammramadhan/gabble/internal/config"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a single JWT signing or verification key. Private is nil for keys
+// that are only accepted for verification.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// KeySet holds the active signing key plus every key tokens may still be
+// verified with, indexed by the "kid" header.
+type KeySet struct {
+	signing  *Key
+	keys     map[string]*Key
+	methods  []string
+	issuer   string
+	audience string
+}
+
+func LoadKeySet(cfg *config.Config) (*KeySet, error) {
+	ks := &KeySet{
+		keys:     make(map[string]*Key),
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+	}
+
+	signing, err := loadSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ks.signing = signing
+	ks.keys[signing.ID] = signing
+
+	for kid, path := range cfg.JWTVerificationKeys {
+		if _, ok := ks.keys[kid]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", kid)
+		}
+		key, err := loadPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[kid] = key
+	}
+
+	// Only algorithms backed by a configured key are accepted, optionally
+	// narrowed further by JWT_ALLOWED_ALGORITHMS.
+	seen := make(map[string]bool)
+	for kid, key := range ks.keys {
+		alg := key.Method.Alg()
+		if len(cfg.JWTAllowedAlgorithms) > 0 && !contains(cfg.JWTAllowedAlgorithms, alg) {
+			return nil, fmt.Errorf("key %q uses %s which is not in JWT_ALLOWED_ALGORITHMS", kid, alg)
+		}
+		if !seen[alg] {
+			seen[alg] = true
+			ks.methods = append(ks.methods, alg)
+		}
+	}
+
+	return ks, nil
+}
+
+func loadSigningKey(cfg *config.Config) (*Key, error) {
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		kid := cfg.JWTKeyID
+		if kid == "" {
+			kid = "default"
+		}
+		secret := []byte(cfg.JWTSecret)
+		return &Key{ID: kid, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}, nil
+
+	case "RS256", "EdDSA":
+		if cfg.JWTPrivateKeyFile == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", cfg.JWTAlgorithm)
+		}
+		data, err := os.ReadFile(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read private key: %w", err)
+		}
+
+		key := &Key{ID: cfg.JWTKeyID}
+		if cfg.JWTAlgorithm == "RS256" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse RSA private key: %w", err)
+			}
+			key.Method = jwt.SigningMethodRS256
+			key.Private = private
+			key.Public = &private.PublicKey
+		} else {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse Ed25519 private key: %w", err)
+			}
+			key.Method = jwt.SigningMethodEdDSA
+			key.Private = private
+			key.Public = private.(ed25519.PrivateKey).Public()
+		}
+
+		if key.ID == "" {
+			kid, err := thumbprint(key.Public)
+			if err != nil {
+				return nil, err
+			}
+			key.ID = kid
+		}
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+}
+
+func loadPublicKey(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read verification key %q: %w", kid, err)
+	}
+
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: public}, nil
+	}
+	if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: public}, nil
+	}
+	return nil, fmt.Errorf("verification key %q is not an RSA or Ed25519 public key", kid)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func thumbprint(public interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// Sign issues a token for claims using the active signing key, stamping the
+// configured issuer and audience.
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	if ks.issuer != "" {
+		claims["iss"] = ks.issuer
+	}
+	if ks.audience != "" {
+		claims["aud"] = ks.audience
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Private)
+}
+
+// Parse verifies a token against the key named by its "kid" header. Tokens
+// without a kid are checked against the active signing key so tokens issued
+// before rotation support keep working.
+func (ks *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(ks.methods), jwt.WithExpirationRequired()}
+	if ks.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ks.issuer))
+	}
+	if ks.audience != "" {
+		opts = append(opts, jwt.WithAudience(ks.audience))
+	}
+
+	return jwt.Parse(tokenString, ks.keyfunc, opts...)
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	key := ks.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ks.keys[kid]; !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key in the set. Shared
+// HMAC secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for kid, key := range ks.keys {
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: kid}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
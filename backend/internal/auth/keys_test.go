@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilhammramadhan/gabble/internal/config"
+)
+
+func TestParseLegacyToken(t *testing.T) {
+	for _, env := range []string{"JWT_ALGORITHM", "JWT_KEY_ID", "JWT_ISSUER", "JWT_AUDIENCE", "JWT_ALLOWED_ALGORITHMS", "JWT_VERIFICATION_KEYS"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	t.Setenv("JWT_SECRET", "legacy-secret")
+	ks, err := LoadKeySet(config.Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens issued before key rotation had no kid, iss or aud.
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "u1",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("legacy-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ks.Parse(legacy)
+	if err != nil || !token.Valid {
+		t.Fatalf("legacy token rejected: %v", err)
+	}
+	if got := token.Claims.(jwt.MapClaims)["user_id"]; got != "u1" {
+		t.Errorf("user_id = %v, want u1", got)
+	}
+}
+
+func TestParseIssuerAndAudience(t *testing.T) {
+	ks, err := LoadKeySet(&config.Config{
+		JWTAlgorithm: "HS256",
+		JWTSecret:    "secret",
+		JWTIssuer:    "gabble",
+		JWTAudience:  "gabble-web",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	signed, err := ks.Sign(jwt.MapClaims{"user_id": "u1", "exp": exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "u1", "exp": exp, "iss": "other", "aud": "gabble-web",
+	}).SignedString([]byte("secret"))
+	bare, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "u1", "exp": exp,
+	}).SignedString([]byte("secret"))
+	expired, _ := ks.Sign(jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"signed", signed, true},
+		{"wrong issuer", foreign, false},
+		{"missing issuer and audience", bare, false},
+		{"expired", expired, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ks.Parse(tt.token)
+			if (err == nil) != tt.ok {
+				t.Errorf("Parse error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
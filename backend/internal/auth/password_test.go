@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		hashedWith string
+		configured string
+		wantRehash bool
+	}{
+		{"argon2id", HashArgon2id, HashArgon2id, false},
+		{"default is argon2id", "", "", false},
+		{"bcrypt", HashBcrypt, HashBcrypt, false},
+		{"bcrypt upgraded to argon2id", HashBcrypt, HashArgon2id, true},
+		{"argon2id downgraded to bcrypt", HashArgon2id, HashBcrypt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashPassword("correct horse", tt.hashedWith)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ok, rehash, err := VerifyPassword(hash, "correct horse", tt.configured)
+			if err != nil || !ok {
+				t.Fatalf("VerifyPassword(right password) = %v, %v", ok, err)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("rehash = %v, want %v", rehash, tt.wantRehash)
+			}
+
+			ok, rehash, err = VerifyPassword(hash, "wrong horse", tt.configured)
+			if err != nil || ok || rehash {
+				t.Errorf("VerifyPassword(wrong password) = %v, %v, %v", ok, rehash, err)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSalted(t *testing.T) {
+	a, _ := HashPassword("correct horse", HashArgon2id)
+	b, _ := HashPassword("correct horse", HashArgon2id)
+	if a == b {
+		t.Error("two hashes of the same password are identical")
+	}
+	if _, err := HashPassword("correct horse", "md5"); err == nil {
+		t.Error("HashPassword accepted an unknown algorithm")
+	}
+}
+
+func TestVerifyPasswordInvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdA",
+		"$argon2id$v=1$m=65536,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$!!$a2V5",
+	} {
+		if _, _, err := VerifyPassword(hash, "correct horse", HashArgon2id); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("VerifyPassword(%q) err = %v, want ErrInvalidHash", hash, err)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		wantErr  bool
+	}{
+		{"", true},
+		{"short", true},
+		{strings.Repeat("a", MinPasswordLength), false},
+		{strings.Repeat("a", MaxPasswordLength), false},
+		{strings.Repeat("a", MaxPasswordLength+1), true},
+	}
+	for _, tt := range tests {
+		if err := ValidatePassword(tt.password); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePassword(%d chars) error = %v, wantErr %v", len(tt.password), err, tt.wantErr)
+		}
+	}
+}
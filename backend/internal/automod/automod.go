@@ -0,0 +1,324 @@
+// Package automod evaluates messages against auto-moderation rules:
+// blocklisted words and patterns, link domain lists and spam heuristics.
+package automod
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// Rule kinds.
+const (
+	// KindWord matches a word or phrase, ignoring case.
+	KindWord = "word"
+	// KindRegex matches a regular expression.
+	KindRegex = "regex"
+	// KindLinkDeny matches links to a domain or its subdomains.
+	KindLinkDeny = "link_deny"
+	// KindLinkAllow matches links to anywhere but the domains of the
+	// link_allow rules in the same set.
+	KindLinkAllow = "link_allow"
+	// KindRepeat matches the Threshold-th identical message from a user
+	// within RepeatWindow.
+	KindRepeat = "repeat"
+	// KindCaps matches messages whose letters are at least Threshold
+	// percent capitals.
+	KindCaps = "caps"
+	// KindMentions matches messages with more than Threshold @mentions.
+	KindMentions = "mentions"
+)
+
+// Actions, from least to most severe. Mask replaces the matched text with
+// asterisks, flag posts the message but records it for review, reject
+// refuses it and mute also stops the author posting in the room for a
+// while.
+const (
+	ActionMask   = "mask"
+	ActionFlag   = "flag"
+	ActionReject = "reject"
+	ActionMute   = "mute"
+)
+
+var severity = map[string]int{
+	ActionMask:   1,
+	ActionFlag:   2,
+	ActionReject: 3,
+	ActionMute:   4,
+}
+
+// capsMinLetters keeps short messages such as "OK" clear of the caps rule.
+const capsMinLetters = 10
+
+var (
+	linkPattern    = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	mentionPattern = regexp.MustCompile(`(?:^|\s)@\w+`)
+)
+
+// ContainsLink reports whether content has something clients render as a
+// link.
+func ContainsLink(content string) bool {
+	return linkPattern.MatchString(content)
+}
+
+// Validate checks a rule before it is saved, normalising its pattern.
+func Validate(rule *models.AutomodRule) error {
+	if _, ok := severity[rule.Action]; !ok {
+		return errors.New("action must be mask, flag, reject or mute")
+	}
+
+	switch rule.Kind {
+	case KindWord:
+		rule.Pattern = strings.TrimSpace(rule.Pattern)
+		if rule.Pattern == "" {
+			return errors.New("pattern is required")
+		}
+	case KindRegex:
+		if rule.Pattern == "" {
+			return errors.New("pattern is required")
+		}
+		re, err := syntax.Parse(rule.Pattern, syntax.Perl)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		if matchesEmpty(re) {
+			return errors.New("pattern must not match empty text")
+		}
+	case KindLinkDeny, KindLinkAllow:
+		rule.Pattern = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(rule.Pattern)), ".")
+		if rule.Pattern == "" || strings.ContainsAny(rule.Pattern, "/: ") {
+			return errors.New("pattern must be a domain such as example.com")
+		}
+	case KindRepeat, KindMentions:
+		if rule.Threshold < 1 {
+			return errors.New("threshold must be at least 1")
+		}
+	case KindCaps:
+		if rule.Threshold < 1 || rule.Threshold > 100 {
+			return errors.New("threshold must be a percentage between 1 and 100")
+		}
+	default:
+		return errors.New("kind must be word, regex, link_deny, link_allow, repeat, caps or mentions")
+	}
+
+	if rule.Action == ActionMask {
+		switch rule.Kind {
+		case KindWord, KindRegex, KindLinkDeny, KindLinkAllow:
+		default:
+			return errors.New("mask only applies to word, regex and link rules")
+		}
+	}
+	return nil
+}
+
+// matchesEmpty reports whether re can match without consuming any text,
+// such as "a*" or "^", which would hit every message.
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary, syntax.OpStar, syntax.OpQuest:
+		return true
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type compiled struct {
+	rule    models.AutomodRule
+	pattern *regexp.Regexp
+}
+
+// RuleSet is a compiled list of rules, safe for concurrent use.
+type RuleSet struct {
+	rules []compiled
+	// allowed is the domains of the link_allow rules.
+	allowed []string
+}
+
+// Compile prepares rules for Evaluate. Rules that no longer validate are
+// logged and skipped.
+func Compile(rules []models.AutomodRule) *RuleSet {
+	set := &RuleSet{}
+	for _, rule := range rules {
+		if err := Validate(&rule); err != nil {
+			log.Printf("skipping automod rule %s: %v", rule.ID, err)
+			continue
+		}
+
+		c := compiled{rule: rule}
+		switch rule.Kind {
+		case KindWord:
+			c.pattern = regexp.MustCompile(`(?i)(?:^|\b)` + regexp.QuoteMeta(rule.Pattern) + `(?:\b|$)`)
+		case KindRegex:
+			c.pattern = regexp.MustCompile(rule.Pattern)
+		case KindLinkAllow:
+			set.allowed = append(set.allowed, rule.Pattern)
+		}
+		set.rules = append(set.rules, c)
+	}
+	return set
+}
+
+// Input is a message to evaluate. Repeats is how many times its author has
+// sent the same text within RepeatWindow, this message included.
+type Input struct {
+	Content string
+	Repeats int
+}
+
+type Hit struct {
+	Rule models.AutomodRule
+}
+
+// Verdict is the outcome of Evaluate. Content has the mask rules applied
+// and Action is the most severe action of any hit, or "" if none.
+type Verdict struct {
+	Content string
+	Action  string
+	Hits    []Hit
+}
+
+// Evaluate runs the message through each set in turn, such as the
+// server-wide rules and then the room's.
+func Evaluate(in Input, sets ...*RuleSet) Verdict {
+	v := Verdict{Content: in.Content}
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		// A message with several disallowed links is one hit, not one per
+		// link_allow rule.
+		allowHit := false
+		for _, c := range set.rules {
+			spans := c.match(set, in)
+			if len(spans) == 0 || (c.rule.Kind == KindLinkAllow && allowHit) {
+				continue
+			}
+			if c.rule.Kind == KindLinkAllow {
+				allowHit = true
+			}
+
+			v.Hits = append(v.Hits, Hit{Rule: c.rule})
+			if severity[c.rule.Action] > severity[v.Action] {
+				v.Action = c.rule.Action
+			}
+			if c.rule.Action == ActionMask {
+				v.Content = mask(v.Content, c, set)
+			}
+		}
+	}
+	return v
+}
+
+// match returns the spans of in.Content the rule matched, or for the
+// heuristics a single span covering the whole message.
+func (c compiled) match(set *RuleSet, in Input) [][]int {
+	whole := [][]int{{0, len(in.Content)}}
+	switch c.rule.Kind {
+	case KindWord, KindRegex:
+		return c.pattern.FindAllStringIndex(in.Content, -1)
+	case KindLinkDeny:
+		return linkSpans(in.Content, func(host string) bool { return inDomain(host, c.rule.Pattern) })
+	case KindLinkAllow:
+		return linkSpans(in.Content, func(host string) bool {
+			for _, domain := range set.allowed {
+				if inDomain(host, domain) {
+					return false
+				}
+			}
+			return true
+		})
+	case KindRepeat:
+		if in.Repeats >= c.rule.Threshold {
+			return whole
+		}
+	case KindCaps:
+		if capsPercent(in.Content) >= c.rule.Threshold {
+			return whole
+		}
+	case KindMentions:
+		if len(mentionPattern.FindAllStringIndex(in.Content, -1)) > c.rule.Threshold {
+			return whole
+		}
+	}
+	return nil
+}
+
+// mask re-matches against content, which earlier masks may have changed,
+// and replaces each match with asterisks.
+func mask(content string, c compiled, set *RuleSet) string {
+	spans := c.match(set, Input{Content: content})
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(content[last:span[0]])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(content[span[0]:span[1]])))
+		last = span[1]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func linkSpans(content string, match func(host string) bool) [][]int {
+	var spans [][]int
+	for _, span := range linkPattern.FindAllStringIndex(content, -1) {
+		link := content[span[0]:span[1]]
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if match(strings.ToLower(u.Hostname())) {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func inDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func capsPercent(content string) int {
+	letters, upper := 0, 0
+	for _, r := range content {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters < capsMinLetters {
+		return 0
+	}
+	return upper * 100 / letters
+}
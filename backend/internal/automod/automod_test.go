@@ -0,0 +1,169 @@
+package automod
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.AutomodRule
+		wantErr bool
+	}{
+		{"word", models.AutomodRule{Kind: KindWord, Pattern: " spam ", Action: ActionReject}, false},
+		{"empty word", models.AutomodRule{Kind: KindWord, Pattern: "  ", Action: ActionReject}, true},
+		{"regex", models.AutomodRule{Kind: KindRegex, Pattern: `fr[e3]{2}\s*money`, Action: ActionFlag}, false},
+		{"regex plus", models.AutomodRule{Kind: KindRegex, Pattern: `a+`, Action: ActionMask}, false},
+		{"invalid regex", models.AutomodRule{Kind: KindRegex, Pattern: `(`, Action: ActionFlag}, true},
+		{"regex star", models.AutomodRule{Kind: KindRegex, Pattern: `a*`, Action: ActionReject}, true},
+		{"regex optional", models.AutomodRule{Kind: KindRegex, Pattern: `(?:spam)?`, Action: ActionReject}, true},
+		{"regex anchor", models.AutomodRule{Kind: KindRegex, Pattern: `^`, Action: ActionMute}, true},
+		{"regex boundary", models.AutomodRule{Kind: KindRegex, Pattern: `\b`, Action: ActionReject}, true},
+		{"regex empty alternative", models.AutomodRule{Kind: KindRegex, Pattern: `spam|`, Action: ActionReject}, true},
+		{"regex zero repeat", models.AutomodRule{Kind: KindRegex, Pattern: `x{0,3}`, Action: ActionReject}, true},
+		{"regex anchored word", models.AutomodRule{Kind: KindRegex, Pattern: `^spam$`, Action: ActionReject}, false},
+		{"link domain", models.AutomodRule{Kind: KindLinkDeny, Pattern: ".Example.com", Action: ActionMask}, false},
+		{"link url", models.AutomodRule{Kind: KindLinkDeny, Pattern: "https://example.com", Action: ActionMask}, true},
+		{"caps over 100", models.AutomodRule{Kind: KindCaps, Threshold: 101, Action: ActionFlag}, true},
+		{"repeat without threshold", models.AutomodRule{Kind: KindRepeat, Action: ActionMute}, true},
+		{"mask caps", models.AutomodRule{Kind: KindCaps, Threshold: 80, Action: ActionMask}, true},
+		{"unknown action", models.AutomodRule{Kind: KindWord, Pattern: "spam", Action: "ban"}, true},
+		{"unknown kind", models.AutomodRule{Kind: "emoji", Action: ActionFlag}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			err := Validate(&rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompileSkipsEmptyMatchingRegex(t *testing.T) {
+	set := Compile([]models.AutomodRule{
+		{ID: "r1", Kind: KindRegex, Pattern: `a*`, Action: ActionReject},
+	})
+	if v := Evaluate(Input{Content: "hello", Repeats: 1}, set); v.Action != "" {
+		t.Errorf("Evaluate action = %q, want none", v.Action)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	server := Compile([]models.AutomodRule{
+		{ID: "slur", Kind: KindWord, Pattern: "darn", Action: ActionMask},
+		{ID: "money", Kind: KindRegex, Pattern: `fr[e3]{2}\s*money`, Action: ActionReject},
+	})
+	room := Compile([]models.AutomodRule{
+		{ID: "allow", Kind: KindLinkAllow, Pattern: "example.com", Action: ActionFlag},
+		{ID: "allow2", Kind: KindLinkAllow, Pattern: "golang.org", Action: ActionFlag},
+		{ID: "deny", Kind: KindLinkDeny, Pattern: "evil.test", Action: ActionMask},
+		{ID: "caps", Kind: KindCaps, Threshold: 80, Action: ActionFlag},
+		{ID: "mentions", Kind: KindMentions, Threshold: 2, Action: ActionReject},
+		{ID: "repeat", Kind: KindRepeat, Threshold: 3, Action: ActionMute},
+	})
+
+	tests := []struct {
+		name        string
+		in          Input
+		wantContent string
+		wantAction  string
+		wantHits    []string
+	}{
+		{"clean", Input{Content: "hello there", Repeats: 1}, "hello there", "", nil},
+		{"mask word", Input{Content: "well Darn it", Repeats: 1}, "well **** it", ActionMask, []string{"slur"}},
+		{"word inside another word", Input{Content: "darnation", Repeats: 1}, "darnation", "", nil},
+		{"regex reject", Input{Content: "get FR33 money? no, fr3e money", Repeats: 1}, "get FR33 money? no, fr3e money", ActionReject, []string{"money"}},
+		{"allowed links", Input{Content: "see https://example.com and https://go.golang.org/x", Repeats: 1}, "see https://example.com and https://go.golang.org/x", "", nil},
+		{"one hit for many links", Input{Content: "https://a.test https://b.test", Repeats: 1}, "https://a.test https://b.test", ActionFlag, []string{"allow"}},
+		{"denied link", Input{Content: "go to www.sub.evil.test now", Repeats: 1}, "go to ***************** now", ActionFlag, []string{"allow", "deny"}},
+		{"caps", Input{Content: "WHY IS EVERYONE SHOUTING", Repeats: 1}, "WHY IS EVERYONE SHOUTING", ActionFlag, []string{"caps"}},
+		{"short caps", Input{Content: "OK OK", Repeats: 1}, "OK OK", "", nil},
+		{"mentions", Input{Content: "@a @b @c hi", Repeats: 1}, "@a @b @c hi", ActionReject, []string{"mentions"}},
+		{"repeat", Input{Content: "buy now", Repeats: 3}, "buy now", ActionMute, []string{"repeat"}},
+		{"most severe wins", Input{Content: "darn, free money", Repeats: 3}, "****, free money", ActionMute, []string{"slur", "money", "repeat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Evaluate(tt.in, server, nil, room)
+			if v.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", v.Content, tt.wantContent)
+			}
+			if v.Action != tt.wantAction {
+				t.Errorf("Action = %q, want %q", v.Action, tt.wantAction)
+			}
+			var got []string
+			for _, hit := range v.Hits {
+				got = append(got, hit.Rule.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantHits, ",") {
+				t.Errorf("Hits = %v, want %v", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestRepeats(t *testing.T) {
+	r := NewRepeats()
+	now := time.Now()
+
+	if n, _ := r.Add("u1", "c1", "Buy now", now); n != 1 {
+		t.Fatalf("first = %d, want 1", n)
+	}
+	if n, _ := r.Add("u1", "c2", "  buy   NOW ", now.Add(time.Second)); n != 2 {
+		t.Fatalf("same text ignoring case and spaces = %d, want 2", n)
+	}
+	if n, _ := r.Add("u1", "c2", "buy now", now.Add(2*time.Second)); n != 2 {
+		t.Fatalf("retry of c2 = %d, want 2", n)
+	}
+	if n, _ := r.Add("u2", "c1", "buy now", now.Add(2*time.Second)); n != 1 {
+		t.Fatalf("another user = %d, want 1", n)
+	}
+	if n, _ := r.Add("u1", "c3", "buy now", now.Add(RepeatWindow+500*time.Millisecond)); n != 2 {
+		t.Fatalf("after the first left the window = %d, want 2", n)
+	}
+}
+
+func TestRepeatsUndo(t *testing.T) {
+	r := NewRepeats()
+	now := time.Now()
+
+	r.Add("u1", "c1", "spam", now)
+	_, undo := r.Add("u1", "c2", "spam", now.Add(time.Second))
+	undo()
+	if n, _ := r.Add("u1", "c3", "spam", now.Add(2*time.Second)); n != 2 {
+		t.Fatalf("after undoing c2 = %d, want 2", n)
+	}
+
+	// Undoing a retry leaves the original entry counted.
+	_, undo = r.Add("u1", "c1", "spam", now.Add(3*time.Second))
+	undo()
+	if n, _ := r.Add("u1", "c4", "spam", now.Add(4*time.Second)); n != 3 {
+		t.Fatalf("after undoing a retry = %d, want 3", n)
+	}
+}
+
+func TestRepeatsConcurrent(t *testing.T) {
+	r := NewRepeats()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.Add("u1", fmt.Sprintf("c%d", i), "spam", now)
+		}(i)
+	}
+	wg.Wait()
+	if n, _ := r.Add("u1", "last", "spam", now); n != 51 {
+		t.Errorf("count after 50 concurrent adds = %d, want 51", n)
+	}
+}
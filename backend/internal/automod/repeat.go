@@ -0,0 +1,92 @@
+package automod
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RepeatWindow is how far back Repeats looks for identical messages.
+const RepeatWindow = time.Minute
+
+// Repeats counts how often each user sends the same text, for repeat
+// rules.
+type Repeats struct {
+	mu       sync.Mutex
+	byUser   map[string][]sent
+	prunedAt time.Time
+	next     uint64
+}
+
+type sent struct {
+	n    uint64
+	id   string
+	text string
+	at   time.Time
+}
+
+func NewRepeats() *Repeats {
+	return &Repeats{byUser: make(map[string][]sent)}
+}
+
+// Add records a message from userID and returns how many times, this one
+// included, they have sent the same text within RepeatWindow. Case and
+// whitespace are ignored. A retry carrying the clientMsgID of a message
+// already counted is not counted again. undo takes the message back out,
+// for one that ends up not being stored.
+func (r *Repeats) Add(userID, clientMsgID, content string, now time.Time) (count int, undo func()) {
+	text := strings.ToLower(strings.Join(strings.Fields(content), " "))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.prunedAt) > RepeatWindow {
+		for id, history := range r.byUser {
+			if now.Sub(history[len(history)-1].at) > RepeatWindow {
+				delete(r.byUser, id)
+			}
+		}
+		r.prunedAt = now
+	}
+
+	history := r.byUser[userID]
+	kept := history[:0]
+	count, retry := 1, false
+	for _, s := range history {
+		if now.Sub(s.at) > RepeatWindow {
+			continue
+		}
+		kept = append(kept, s)
+		if clientMsgID != "" && s.id == clientMsgID {
+			retry = true
+		} else if s.text == text {
+			count++
+		}
+	}
+	if retry {
+		r.byUser[userID] = kept
+		return count, func() {}
+	}
+	r.next++
+	n := r.next
+	r.byUser[userID] = append(kept, sent{n: n, id: clientMsgID, text: text, at: now})
+	return count, func() { r.remove(userID, n) }
+}
+
+func (r *Repeats) remove(userID string, n uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := r.byUser[userID]
+	for i, s := range history {
+		if s.n == n {
+			history = append(history[:i], history[i+1:]...)
+			break
+		}
+	}
+	if len(history) == 0 {
+		delete(r.byUser, userID)
+	} else {
+		r.byUser[userID] = history
+	}
+}
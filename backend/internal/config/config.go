@@ -1,29 +1,266 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const DefaultJWTSecret = "your-secret-key"
+
 type Config struct {
-	Port            string
-	DatabaseURL     string
-	GithubClientID  string
-	GithubSecret    string
-	JWTSecret       string
-	FrontendURL     string
-	Environment     string
+	Port           string
+	DatabaseURL    string
+	GithubClientID string
+	GithubSecret   string
+	JWTSecret      string
+	FrontendURL    string
+	Environment    string
+
+	// AllowedOrigins lists browser origins, besides FrontendURL, allowed to
+	// call the API and open WebSockets; see OriginPolicy.
+	AllowedOrigins []string
+	// AllowLocalhostOrigins also allows any localhost origin. It defaults
+	// to on outside production.
+	AllowLocalhostOrigins bool
+	// TrustedProxies lists the addresses and CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed. Requests
+	// from anywhere else are keyed on their connection address.
+	TrustedProxies []string
+
+	// JWTAlgorithm selects how tokens are signed: HS256 uses JWTSecret,
+	// RS256 and EdDSA use the PEM private key in JWTPrivateKeyFile.
+	JWTAlgorithm      string
+	JWTPrivateKeyFile string
+	JWTKeyID          string
+	// JWTVerificationKeys lists extra public keys that are still accepted
+	// during a rotation, as comma separated "kid=path/to/key.pem" pairs.
+	JWTVerificationKeys map[string]string
+	JWTIssuer           string
+	JWTAudience         string
+	// JWTAllowedAlgorithms optionally restricts which "alg" headers are
+	// accepted; by default any algorithm with a configured key is allowed.
+	JWTAllowedAlgorithms []string
+	AuthCacheTTL         time.Duration
+
+	// AuthProviders lists the enabled login methods: "github" and/or
+	// "local" username/password accounts.
+	AuthProviders         []string
+	LocalRegistration     bool
+	PasswordHashAlgorithm string
+	LoginMaxAttempts      int
+	LoginLockoutDuration  time.Duration
+	PasswordResetTTL      time.Duration
+	// AdminUsers names the accounts allowed to administer the server by
+	// stable ID, as "github:<GitHub user ID>" or "user:<user ID>".
+	AdminUsers []string
+
+	// WSSlowConsumerPolicy is what happens when a WebSocket client's send
+	// buffer fills: "drop_oldest", "drop_typing" or "disconnect".
+	WSSlowConsumerPolicy string
+	// WSMaxMessageSize is the largest frame, in bytes, a client may send;
+	// larger ones close the connection with 1009.
+	WSMaxMessageSize  int
+	WSReadBufferSize  int
+	WSWriteBufferSize int
+	// WSSendBufferSize is how many outbound frames a client may have queued.
+	WSSendBufferSize int
+	WSWriteWait      time.Duration
+	WSPongWait       time.Duration
+	// WSCompression offers permessage-deflate; frames smaller than
+	// WSCompressionThreshold bytes are still sent uncompressed.
+	WSCompression          bool
+	WSCompressionThreshold int
+	// WSMaxConnections, WSMaxConnectionsPerUser and WSMaxConnectionsPerIP
+	// cap live connections over every transport; 0 means no limit. With
+	// WSEvictOldest a user at their cap replaces their oldest connection.
+	WSMaxConnections        int
+	WSMaxConnectionsPerUser int
+	WSMaxConnectionsPerIP   int
+	WSEvictOldest           bool
+
+	// Rate limits, each written as "<count>/<duration>" or "off"; see
+	// RateLimits.
+	RateLimitIP         string
+	RateLimitUser       string
+	RateLimitRoomCreate string
+	RateLimitWSMessages string
+	RateLimitWSTyping   string
+	RateLimitWSEvents   string
+	RateLimitWSAbuse    string
+
+	// AutomodMuteDuration is how long the mute action of an
+	// auto-moderation rule lasts.
+	AutomodMuteDuration time.Duration
+	MaxPinsPerRoom      int
+
+	// loadErrors are the settings Load could not parse.
+	loadErrors []error
 }
 
 func Load() *Config {
-	return &Config{
-		Port:            getEnv("PORT", "8080"),
-		DatabaseURL:     getEnv("DATABASE_URL", ""),
-		GithubClientID:  getEnv("GITHUB_CLIENT_ID", ""),
-		GithubSecret:    getEnv("GITHUB_CLIENT_SECRET", ""),
-		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
-		FrontendURL:     getEnv("FRONTEND_URL", "http://localhost:3000"),
-		Environment:     getEnv("ENVIRONMENT", "development"),
+	environment := getEnv("ENVIRONMENT", "development")
+
+	var errs envErrors
+	cfg := &Config{
+		Port:           getEnv("PORT", "8080"),
+		DatabaseURL:    getEnv("DATABASE_URL", ""),
+		GithubClientID: getEnv("GITHUB_CLIENT_ID", ""),
+		GithubSecret:   getEnv("GITHUB_CLIENT_SECRET", ""),
+		JWTSecret:      getEnv("JWT_SECRET", DefaultJWTSecret),
+		FrontendURL:    getEnv("FRONTEND_URL", "http://localhost:3000"),
+		Environment:    environment,
+
+		AllowedOrigins:        getEnvList("ALLOWED_ORIGINS"),
+		AllowLocalhostOrigins: errs.getEnvBool("ALLOW_LOCALHOST_ORIGINS", environment != "production"),
+		TrustedProxies:        getEnvList("TRUSTED_PROXIES"),
+
+		JWTAlgorithm:         getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile:    getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTKeyID:             getEnv("JWT_KEY_ID", ""),
+		JWTVerificationKeys:  getEnvMap("JWT_VERIFICATION_KEYS"),
+		JWTIssuer:            getEnv("JWT_ISSUER", ""),
+		JWTAudience:          getEnv("JWT_AUDIENCE", ""),
+		JWTAllowedAlgorithms: getEnvList("JWT_ALLOWED_ALGORITHMS"),
+		AuthCacheTTL:         errs.getEnvDuration("AUTH_CACHE_TTL", 30*time.Second),
+
+		AuthProviders:         getEnvList("AUTH_PROVIDERS"),
+		LocalRegistration:     errs.getEnvBool("LOCAL_REGISTRATION", true),
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		LoginMaxAttempts:      errs.getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginLockoutDuration:  errs.getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		PasswordResetTTL:      errs.getEnvDuration("PASSWORD_RESET_TTL", 24*time.Hour),
+		AdminUsers:            getEnvList("ADMIN_USERS"),
+
+		WSSlowConsumerPolicy:   getEnv("WS_SLOW_CONSUMER_POLICY", "drop_typing"),
+		WSMaxMessageSize:       errs.getEnvInt("WS_MAX_MESSAGE_SIZE", 4096),
+		WSReadBufferSize:       errs.getEnvInt("WS_READ_BUFFER_SIZE", 1024),
+		WSWriteBufferSize:      errs.getEnvInt("WS_WRITE_BUFFER_SIZE", 1024),
+		WSSendBufferSize:       errs.getEnvInt("WS_SEND_BUFFER_SIZE", 256),
+		WSWriteWait:            errs.getEnvDuration("WS_WRITE_WAIT", 10*time.Second),
+		WSPongWait:             errs.getEnvDuration("WS_PONG_WAIT", 60*time.Second),
+		WSCompression:          errs.getEnvBool("WS_COMPRESSION", true),
+		WSCompressionThreshold: errs.getEnvInt("WS_COMPRESSION_THRESHOLD", 512),
+
+		WSMaxConnections:        errs.getEnvInt("WS_MAX_CONNECTIONS", 10000),
+		WSMaxConnectionsPerUser: errs.getEnvInt("WS_MAX_CONNECTIONS_PER_USER", 10),
+		WSMaxConnectionsPerIP:   errs.getEnvInt("WS_MAX_CONNECTIONS_PER_IP", 100),
+		WSEvictOldest:           errs.getEnvBool("WS_EVICT_OLDEST", false),
+
+		RateLimitIP:         getEnv("RATE_LIMIT_IP", "300/m"),
+		RateLimitUser:       getEnv("RATE_LIMIT_USER", "120/m"),
+		RateLimitRoomCreate: getEnv("RATE_LIMIT_ROOM_CREATE", "10/h"),
+		RateLimitWSMessages: getEnv("RATE_LIMIT_WS_MESSAGES", "10/10s"),
+		RateLimitWSTyping:   getEnv("RATE_LIMIT_WS_TYPING", "30/10s"),
+		RateLimitWSEvents:   getEnv("RATE_LIMIT_WS_EVENTS", "60/10s"),
+		RateLimitWSAbuse:    getEnv("RATE_LIMIT_WS_ABUSE", "30/m"),
+
+		AutomodMuteDuration: errs.getEnvDuration("AUTOMOD_MUTE_DURATION", 10*time.Minute),
+		MaxPinsPerRoom:      errs.getEnvInt("MAX_PINS_PER_ROOM", 50),
+	}
+	cfg.loadErrors = errs
+	return cfg
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+func (c *Config) GithubAuthEnabled() bool {
+	return len(c.AuthProviders) == 0 || contains(c.AuthProviders, "github")
+}
+
+func (c *Config) LocalAuthEnabled() bool {
+	return contains(c.AuthProviders, "local")
+}
+
+// IsAdminAccount reports whether the account with userID and, for GitHub
+// accounts, githubID is listed in ADMIN_USERS.
+func (c *Config) IsAdminAccount(userID, githubID string) bool {
+	for _, admin := range c.AdminUsers {
+		kind, id, ok := strings.Cut(admin, ":")
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "github":
+			if githubID != "" && id == githubID {
+				return true
+			}
+		case "user":
+			if strings.EqualFold(id, userID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate rejects configurations that are unsafe to run with.
+func (c *Config) Validate() error {
+	if len(c.loadErrors) > 0 {
+		return errors.Join(c.loadErrors...)
+	}
+	if c.IsProduction() && c.JWTAlgorithm == "HS256" && (c.JWTSecret == "" || c.JWTSecret == DefaultJWTSecret) {
+		return errors.New("JWT_SECRET must be set to a non-default value in production")
+	}
+	for _, provider := range c.AuthProviders {
+		if provider != "github" && provider != "local" {
+			return fmt.Errorf("unknown auth provider %q", provider)
+		}
+	}
+	for _, admin := range c.AdminUsers {
+		kind, id, _ := strings.Cut(admin, ":")
+		if (kind != "github" && kind != "user") || id == "" {
+			return fmt.Errorf("invalid ADMIN_USERS entry %q: use github:<GitHub user ID> or user:<user ID>", admin)
+		}
+	}
+	if _, err := c.OriginPolicy(); err != nil {
+		return err
 	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		return err
+	}
+	if _, err := c.RateLimits(); err != nil {
+		return err
+	}
+	if c.AutomodMuteDuration <= 0 {
+		return errors.New("AUTOMOD_MUTE_DURATION must be positive")
+	}
+	if c.MaxPinsPerRoom <= 0 {
+		return errors.New("MAX_PINS_PER_ROOM must be positive")
+	}
+	if c.PasswordHashAlgorithm != "argon2id" && c.PasswordHashAlgorithm != "bcrypt" {
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q", c.PasswordHashAlgorithm)
+	}
+	switch c.WSSlowConsumerPolicy {
+	case "drop_oldest", "drop_typing", "disconnect":
+	default:
+		return fmt.Errorf("unknown WS_SLOW_CONSUMER_POLICY %q", c.WSSlowConsumerPolicy)
+	}
+	for name, value := range map[string]int{
+		"WS_MAX_MESSAGE_SIZE":  c.WSMaxMessageSize,
+		"WS_READ_BUFFER_SIZE":  c.WSReadBufferSize,
+		"WS_WRITE_BUFFER_SIZE": c.WSWriteBufferSize,
+		"WS_SEND_BUFFER_SIZE":  c.WSSendBufferSize,
+	} {
+		if value <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	if c.WSWriteWait <= 0 || c.WSPongWait <= 0 {
+		return errors.New("WS_WRITE_WAIT and WS_PONG_WAIT must be positive")
+	}
+	if c.WSCompressionThreshold < 0 {
+		return errors.New("WS_COMPRESSION_THRESHOLD must not be negative")
+	}
+	if c.WSMaxConnections < 0 || c.WSMaxConnectionsPerUser < 0 || c.WSMaxConnectionsPerIP < 0 {
+		return errors.New("WS_MAX_CONNECTIONS limits must not be negative")
+	}
+	return nil
 }
 
 func getEnv(key, fallback string) string {
@@ -32,3 +269,77 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// envErrors collects the settings Load could not parse, for Validate to
+// report, rather than quietly running with the defaults.
+type envErrors []error
+
+func (e *envErrors) getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*e = append(*e, fmt.Errorf("%s: %q is not a boolean", key, value))
+		return fallback
+	}
+	return b
+}
+
+func (e *envErrors) getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		*e = append(*e, fmt.Errorf("%s: %q is not an integer", key, value))
+		return fallback
+	}
+	return i
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (e *envErrors) getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		*e = append(*e, fmt.Errorf("%s: %q is not a duration such as 30s or 15m", key, value))
+		return fallback
+	}
+	return d
+}
+
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" || v == "" {
+			continue
+		}
+		values[k] = v
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsAdminAccount(t *testing.T) {
+	c := &Config{AdminUsers: []string{"github:583231", "user:3F2504E0-4F89-11D3-9A0C-0305E82C3301", "local:admin"}}
+
+	tests := []struct {
+		name     string
+		userID   string
+		githubID string
+		want     bool
+	}{
+		{"github id", "a1", "583231", true},
+		{"user id", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", "", true},
+		{"other github id", "a2", "1", false},
+		{"local account named in a legacy entry", "a3", "", false},
+		{"github id given as user id", "583231", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.IsAdminAccount(tt.userID, tt.githubID); got != tt.want {
+				t.Errorf("IsAdminAccount(%q, %q) = %v, want %v", tt.userID, tt.githubID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsMalformedSettings(t *testing.T) {
+	t.Setenv("WS_MAX_CONNECTIONS", "10k")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "15")
+	t.Setenv("WS_EVICT_OLDEST", "sometimes")
+	t.Setenv("WS_SEND_BUFFER_SIZE", "")
+
+	err := Load().Validate()
+	if err == nil {
+		t.Fatal("Validate accepted malformed settings")
+	}
+	for _, key := range []string{"WS_MAX_CONNECTIONS", "LOGIN_LOCKOUT_DURATION", "WS_EVICT_OLDEST"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not name %s", err, key)
+		}
+	}
+	if strings.Contains(err.Error(), "WS_SEND_BUFFER_SIZE") {
+		t.Errorf("empty WS_SEND_BUFFER_SIZE reported instead of using the default: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// OriginPolicy decides which browser origins may call the API and open
+// WebSocket connections.
+type OriginPolicy struct {
+	exact          map[string]bool
+	patterns       []*regexp.Regexp
+	allowLocalhost bool
+}
+
+// OriginPolicy builds the policy from FRONTEND_URL, ALLOWED_ORIGINS and
+// ALLOW_LOCALHOST_ORIGINS. An entry is either an exact origin such as
+// "https://chat.example.com" or a pattern in which each "*" stands for part
+// of a single host label, such as "https://gabble-*.vercel.app".
+func (c *Config) OriginPolicy() (*OriginPolicy, error) {
+	p := &OriginPolicy{
+		exact:          make(map[string]bool),
+		allowLocalhost: c.AllowLocalhostOrigins,
+	}
+
+	origins := c.AllowedOrigins
+	if c.FrontendURL != "" {
+		origins = append([]string{c.FrontendURL}, origins...)
+	}
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+		u, err := url.Parse(strings.ReplaceAll(origin, "*", "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return nil, fmt.Errorf("invalid allowed origin %q", origin)
+		}
+
+		if !strings.Contains(origin, "*") {
+			p.exact[origin] = true
+			continue
+		}
+		parts := strings.Split(origin, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		p.patterns = append(p.patterns, regexp.MustCompile("^"+strings.Join(parts, "[a-z0-9-]+")+"$"))
+	}
+	return p, nil
+}
+
+// Allow reports whether origin, the value of an Origin header, is allowed.
+func (p *OriginPolicy) Allow(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return p.allowLocalhost && isLocalhost(origin)
+}
+
+func isLocalhost(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,56 @@
+package config
+
+import "testing"
+
+func TestOriginPolicy(t *testing.T) {
+	c := &Config{
+		FrontendURL:    "https://chat.example.com/",
+		AllowedOrigins: []string{"https://gabble-*.vercel.app", "HTTP://Admin.Example.com"},
+	}
+	p, err := c.OriginPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := &Config{AllowLocalhostOrigins: true}
+	lp, err := local.OriginPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy *OriginPolicy
+		origin string
+		want   bool
+	}{
+		{p, "https://chat.example.com", true},
+		{p, "https://CHAT.example.com", true},
+		{p, "http://chat.example.com", false},
+		{p, "https://chat.example.com.evil.test", false},
+		{p, "http://admin.example.com", true},
+		{p, "https://gabble-pr-12.vercel.app", true},
+		{p, "https://gabble-.vercel.app", false},
+		{p, "https://gabble-a.b.vercel.app", false},
+		{p, "https://gabble-x.vercel.app.evil.test", false},
+		{p, "http://localhost:3000", false},
+		{p, "", false},
+		{lp, "http://localhost:3000", true},
+		{lp, "https://127.0.0.1", true},
+		{lp, "http://[::1]:8080", true},
+		{lp, "http://localhost.evil.test", false},
+		{lp, "file://localhost", false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Allow(tt.origin); got != tt.want {
+			t.Errorf("Allow(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestOriginPolicyInvalid(t *testing.T) {
+	for _, origin := range []string{"chat.example.com", "ftp://example.com", "https://example.com/app", "https://"} {
+		c := &Config{AllowedOrigins: []string{origin}}
+		if _, err := c.OriginPolicy(); err == nil {
+			t.Errorf("OriginPolicy accepted %q", origin)
+		}
+	}
+}
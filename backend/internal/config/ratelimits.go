@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ilhammramadhan/gabble/internal/ratelimit"
+)
+
+type RateLimits struct {
+	// IP applies to every HTTP request by client IP and User to
+	// authenticated requests by user; RoomCreate further limits
+	// POST /api/rooms.
+	IP         ratelimit.Limit
+	User       ratelimit.Limit
+	RoomCreate ratelimit.Limit
+	// WSMessages, WSTyping and WSEvents limit send_message, typing and any
+	// other event per user across their connections. A user who keeps
+	// sending past them is disconnected once WSAbuse is exceeded too.
+	WSMessages ratelimit.Limit
+	WSTyping   ratelimit.Limit
+	WSEvents   ratelimit.Limit
+	WSAbuse    ratelimit.Limit
+}
+
+// RateLimits parses the RATE_LIMIT_* settings.
+func (c *Config) RateLimits() (RateLimits, error) {
+	var limits RateLimits
+	for _, l := range []struct {
+		env   string
+		value string
+		limit *ratelimit.Limit
+	}{
+		{"RATE_LIMIT_IP", c.RateLimitIP, &limits.IP},
+		{"RATE_LIMIT_USER", c.RateLimitUser, &limits.User},
+		{"RATE_LIMIT_ROOM_CREATE", c.RateLimitRoomCreate, &limits.RoomCreate},
+		{"RATE_LIMIT_WS_MESSAGES", c.RateLimitWSMessages, &limits.WSMessages},
+		{"RATE_LIMIT_WS_TYPING", c.RateLimitWSTyping, &limits.WSTyping},
+		{"RATE_LIMIT_WS_EVENTS", c.RateLimitWSEvents, &limits.WSEvents},
+		{"RATE_LIMIT_WS_ABUSE", c.RateLimitWSAbuse, &limits.WSAbuse},
+	} {
+		limit, err := ratelimit.Parse(l.value)
+		if err != nil {
+			return RateLimits{}, fmt.Errorf("%s: %w", l.env, err)
+		}
+		*l.limit = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func (db *DB) CreateAPIToken(ctx context.Context, userID, name, tokenHash string, expiresAt *time.Time) (*models.APIToken, error) {
+	var token models.APIToken
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, name, created_at, last_used_at, expires_at
+	`, userID, name, tokenHash, expiresAt).Scan(
+		&token.ID, &token.UserID, &token.Name, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (db *DB) GetAPITokensByUser(ctx context.Context, userID string) ([]models.APIToken, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_id, name, created_at, last_used_at, expires_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		if err := rows.Scan(
+			&token.ID, &token.UserID, &token.Name, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// UseAPIToken looks up an unexpired token by hash and records that it was
+// used, returning the token's ID and owner.
+func (db *DB) UseAPIToken(ctx context.Context, tokenHash string) (tokenID, userID string, err error) {
+	err = db.Pool.QueryRow(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, user_id
+	`, tokenHash).Scan(&tokenID, &userID)
+	return tokenID, userID, err
+}
+
+func (db *DB) DeleteAPIToken(ctx context.Context, id, userID string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM api_tokens WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
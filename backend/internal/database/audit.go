@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+type AuditFilter struct {
+	Action     string
+	ActorID    string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	// BeforeID, when set, keeps only entries older than that ID, for paging
+	// through the log.
+	BeforeID int64
+}
+
+// where builds the WHERE clause for f, returning it with its arguments.
+func (f AuditFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.ActorID != "" {
+		add("actor_id::text = $%d", f.ActorID)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if f.Since != nil {
+		add("created_at >= $%d", *f.Since)
+	}
+	if f.Until != nil {
+		add("created_at < $%d", *f.Until)
+	}
+	if f.BeforeID > 0 {
+		add("id < $%d", f.BeforeID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (db *DB) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO audit_log (action, actor_id, actor_name, target_type, target_id, ip, request_id, metadata)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)
+		RETURNING id, created_at
+	`, entry.Action, entry.ActorID, entry.ActorName, entry.TargetType, entry.TargetID,
+		entry.IP, entry.RequestID, entry.Metadata,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+func (db *DB) GetAuditEntries(ctx context.Context, filter AuditFilter, limit, offset int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := db.EachAuditEntry(ctx, filter, limit, offset, func(entry models.AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// EachAuditEntry streams matching entries, newest first, to fn. A limit of
+// zero means no limit.
+func (db *DB) EachAuditEntry(ctx context.Context, filter AuditFilter, limit, offset int, fn func(models.AuditEntry) error) error {
+	where, args := filter.where()
+	query := `
+		SELECT id, action, COALESCE(actor_id::text, ''), COALESCE(actor_name, ''),
+			   COALESCE(target_type, ''), COALESCE(target_id, ''), COALESCE(ip, ''),
+			   COALESCE(request_id, ''), metadata, created_at
+		FROM audit_log ` + where + `
+		ORDER BY id DESC`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	args = append(args, offset)
+	query += fmt.Sprintf(" OFFSET $%d", len(args))
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(
+			&entry.ID, &entry.Action, &entry.ActorID, &entry.ActorName,
+			&entry.TargetType, &entry.TargetID, &entry.IP,
+			&entry.RequestID, &entry.Metadata, &entry.CreatedAt,
+		); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
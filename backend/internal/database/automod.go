@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func (db *DB) CreateAutomodRule(ctx context.Context, rule *models.AutomodRule) error {
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO automod_rules (room_id, kind, pattern, threshold, action, created_by)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, NULLIF($6, '')::uuid)
+		RETURNING id, created_at
+	`, rule.RoomID, rule.Kind, rule.Pattern, rule.Threshold, rule.Action, rule.CreatedBy,
+	).Scan(&rule.ID, &rule.CreatedAt)
+}
+
+// GetAutomodRules returns the rules for a room, or the server-wide rules
+// when roomID is empty.
+func (db *DB) GetAutomodRules(ctx context.Context, roomID string) ([]models.AutomodRule, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, COALESCE(room_id::text, ''), kind, pattern, threshold, action,
+			   COALESCE(created_by::text, ''), created_at
+		FROM automod_rules
+		WHERE room_id IS NOT DISTINCT FROM NULLIF($1, '')::uuid
+		ORDER BY created_at
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.AutomodRule
+	for rows.Next() {
+		var rule models.AutomodRule
+		if err := rows.Scan(
+			&rule.ID, &rule.RoomID, &rule.Kind, &rule.Pattern, &rule.Threshold,
+			&rule.Action, &rule.CreatedBy, &rule.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// DeleteAutomodRule deletes a rule belonging to roomID, or a server-wide
+// rule when roomID is empty.
+func (db *DB) DeleteAutomodRule(ctx context.Context, ruleID, roomID string) (bool, error) {
+	result, err := db.Pool.Exec(ctx, `
+		DELETE FROM automod_rules
+		WHERE id = $1 AND room_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+	`, ruleID, roomID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (db *DB) CreateAutomodHits(ctx context.Context, hits []models.AutomodHit) error {
+	for i := range hits {
+		hit := &hits[i]
+		err := db.Pool.QueryRow(ctx, `
+			INSERT INTO automod_hits (rule_id, room_id, user_id, message_id, kind, action, content)
+			VALUES (NULLIF($1, '')::uuid, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7)
+			RETURNING id, created_at
+		`, hit.RuleID, hit.RoomID, hit.UserID, hit.MessageID, hit.Kind, hit.Action, hit.Content,
+		).Scan(&hit.ID, &hit.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAutomodHits returns hits newest first, for one room or, when roomID
+// is empty, every room.
+func (db *DB) GetAutomodHits(ctx context.Context, roomID string, limit, offset int) ([]models.AutomodHit, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, COALESCE(rule_id::text, ''), room_id, user_id, COALESCE(message_id::text, ''),
+			   kind, action, content, created_at
+		FROM automod_hits
+		WHERE $1 = '' OR room_id::text = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`, roomID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []models.AutomodHit
+	for rows.Next() {
+		var hit models.AutomodHit
+		if err := rows.Scan(
+			&hit.ID, &hit.RuleID, &hit.RoomID, &hit.UserID, &hit.MessageID,
+			&hit.Kind, &hit.Action, &hit.Content, &hit.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+func (db *DB) MuteUser(ctx context.Context, mute *models.RoomMute) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO room_mutes (room_id, user_id, muted_until, reason, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, '')::uuid)
+		ON CONFLICT (room_id, user_id) DO UPDATE SET
+			muted_until = GREATEST(room_mutes.muted_until, EXCLUDED.muted_until),
+			reason = EXCLUDED.reason,
+			created_by = EXCLUDED.created_by
+	`, mute.RoomID, mute.UserID, mute.MutedUntil, mute.Reason, mute.CreatedBy)
+	return err
+}
+
+// GetActiveRoomMutes returns when each user muted in a room is muted until.
+func (db *DB) GetActiveRoomMutes(ctx context.Context, roomID string) (map[string]time.Time, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT user_id, muted_until FROM room_mutes
+		WHERE room_id = $1 AND muted_until > NOW()
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mutes := make(map[string]time.Time)
+	for rows.Next() {
+		var userID string
+		var until time.Time
+		if err := rows.Scan(&userID, &until); err != nil {
+			return nil, err
+		}
+		mutes[userID] = until
+	}
+	return mutes, rows.Err()
+}
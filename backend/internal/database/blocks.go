@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func (db *DB) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, blockerID, blockedID)
+	return err
+}
+
+func (db *DB) UnblockUser(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`, blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetBlocks returns the users blockerID has blocked, most recent first.
+func (db *DB) GetBlocks(ctx context.Context, blockerID string) ([]models.Block, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT u.id, COALESCE(u.github_id, ''), u.username, u.avatar_url, u.is_admin, u.status, u.created_at,
+			   u.token_version, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []models.Block
+	for rows.Next() {
+		var user models.User
+		var block models.Block
+		if err := scanUser(rows, &user, &block.CreatedAt); err != nil {
+			return nil, err
+		}
+		block.User = &user
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+// GetBlockedIDs returns the set of user IDs blockerID has blocked.
+func (db *DB) GetBlockedIDs(ctx context.Context, blockerID string) (map[string]bool, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+	`, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blocked[id] = true
+	}
+	return blocked, rows.Err()
+}
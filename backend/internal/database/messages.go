@@ -2,33 +2,99 @@ package database
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
-func (db *DB) CreateMessage(ctx context.Context, roomID, userID, content string) (*models.Message, error) {
+const messageColumns = `id, room_id, user_id, seq, COALESCE(client_msg_id, ''), content, created_at`
+
+func scanMessage(row pgx.Row, msg *models.Message) error {
+	return row.Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.Seq, &msg.ClientMsgID, &msg.Content, &msg.CreatedAt)
+}
+
+// CreateMessage stores a message. If the user already sent one with the
+// same non-empty clientMsgID, that message is returned instead and created
+// is false.
+func (db *DB) CreateMessage(ctx context.Context, roomID, userID, content, clientMsgID string) (msg *models.Message, created bool, err error) {
+	msg = &models.Message{}
+	err = scanMessage(db.Pool.QueryRow(ctx, `
+		INSERT INTO messages (room_id, user_id, content, client_msg_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (user_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING `+messageColumns, roomID, userID, content, clientMsgID), msg)
+	if err == nil {
+		return msg, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) || clientMsgID == "" {
+		return nil, false, err
+	}
+
+	msg, err = db.GetMessageByClientMsgID(ctx, userID, clientMsgID)
+	if err != nil {
+		return nil, false, err
+	}
+	return msg, false, nil
+}
+
+// GetMessageByClientMsgID returns the message userID sent with clientMsgID.
+func (db *DB) GetMessageByClientMsgID(ctx context.Context, userID, clientMsgID string) (*models.Message, error) {
+	var msg models.Message
+	err := scanMessage(db.Pool.QueryRow(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE user_id = $1 AND client_msg_id = $2
+	`, userID, clientMsgID), &msg)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (db *DB) GetMessageByID(ctx context.Context, id string) (*models.Message, error) {
 	var msg models.Message
-	err := db.Pool.QueryRow(ctx, `
-		INSERT INTO messages (room_id, user_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING id, room_id, user_id, content, created_at
-	`, roomID, userID, content).Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.CreatedAt)
+	err := scanMessage(db.Pool.QueryRow(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE id = $1
+	`, id), &msg)
 	if err != nil {
 		return nil, err
 	}
 	return &msg, nil
 }
 
-func (db *DB) GetMessagesByRoom(ctx context.Context, roomID string, limit, offset int) ([]models.Message, error) {
+// DeleteMessage deletes a message, reporting whether it existed and
+// whether it was pinned.
+func (db *DB) DeleteMessage(ctx context.Context, id string) (deleted, unpinned bool, err error) {
+	err = db.Pool.QueryRow(ctx, `
+		WITH pin AS (
+			DELETE FROM pinned_messages WHERE message_id = $1 RETURNING message_id
+		)
+		DELETE FROM messages WHERE id = $1
+		RETURNING EXISTS (SELECT 1 FROM pin)
+	`, id).Scan(&unpinned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, unpinned, nil
+}
+
+// GetMessagesByRoom returns a room's history as viewerID sees it, without
+// the messages of users they have blocked.
+func (db *DB) GetMessagesByRoom(ctx context.Context, roomID, viewerID string, limit, offset int) ([]models.Message, error) {
 	rows, err := db.Pool.Query(ctx, `
-		SELECT m.id, m.room_id, m.user_id, m.content, m.created_at,
-			   u.id, u.github_id, u.username, u.avatar_url, u.created_at
+		SELECT m.id, m.room_id, m.user_id, m.seq, COALESCE(m.client_msg_id, ''), m.content, m.created_at,
+			   u.id, COALESCE(u.github_id, ''), u.username, u.avatar_url, u.is_admin, u.status, u.created_at
 		FROM messages m
 		JOIN users u ON m.user_id = u.id
 		WHERE m.room_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = $2 AND b.blocked_id = m.user_id)
 		ORDER BY m.created_at ASC
-		LIMIT $2 OFFSET $3
-	`, roomID, limit, offset)
+		LIMIT $3 OFFSET $4
+	`, roomID, viewerID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -39,8 +105,8 @@ func (db *DB) GetMessagesByRoom(ctx context.Context, roomID string, limit, offse
 		var msg models.Message
 		var user models.User
 		if err := rows.Scan(
-			&msg.ID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.CreatedAt,
-			&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.CreatedAt,
+			&msg.ID, &msg.RoomID, &msg.UserID, &msg.Seq, &msg.ClientMsgID, &msg.Content, &msg.CreatedAt,
+			&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.IsAdmin, &user.Status, &user.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -49,3 +115,38 @@ func (db *DB) GetMessagesByRoom(ctx context.Context, roomID string, limit, offse
 	}
 	return messages, nil
 }
+
+// GetMessagesAfter returns up to limit messages in any of roomIDs with a
+// seq greater than afterSeq, oldest first, for viewerID catching up after a
+// reconnect. Messages from users they have blocked are left out.
+func (db *DB) GetMessagesAfter(ctx context.Context, roomIDs []string, viewerID string, afterSeq int64, limit int) ([]models.Message, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT m.id, m.room_id, m.user_id, m.seq, COALESCE(m.client_msg_id, ''), m.content, m.created_at,
+			   u.id, COALESCE(u.github_id, ''), u.username, u.avatar_url, u.is_admin, u.status, u.created_at
+		FROM messages m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.room_id = ANY($1) AND m.seq > $3
+		  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = $2 AND b.blocked_id = m.user_id)
+		ORDER BY m.seq ASC
+		LIMIT $4
+	`, roomIDs, viewerID, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var msg models.Message
+		var user models.User
+		if err := rows.Scan(
+			&msg.ID, &msg.RoomID, &msg.UserID, &msg.Seq, &msg.ClientMsgID, &msg.Content, &msg.CreatedAt,
+			&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.IsAdmin, &user.Status, &user.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		msg.User = &user
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *DB) CreatePasswordReset(ctx context.Context, userID, createdBy, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO password_resets (user_id, created_by, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, createdBy, tokenHash, expiresAt)
+	return err
+}
+
+// UsePasswordReset redeems an unused, unexpired reset token and sets the
+// account's new password hash in one transaction. Any other outstanding
+// tokens for the account are invalidated, and the token version bump revokes
+// its session tokens. It returns pgx.ErrNoRows when the token is not
+// redeemable.
+func (db *DB) UsePasswordReset(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	err = tx.QueryRow(ctx, `
+		UPDATE password_resets SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE password_resets SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID); err != nil {
+		return "", err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET password_hash = $2, failed_logins = 0, locked_until = NULL,
+			token_version = token_version + 1
+		WHERE id = $1 AND password_hash IS NOT NULL
+	`, userID, passwordHash)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", pgx.ErrNoRows
+	}
+
+	return userID, tx.Commit(ctx)
+}
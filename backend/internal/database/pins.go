@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+var ErrLimitReached = errors.New("limit reached")
+
+// PinMessage pins a message in its room unless the room already has max
+// pins, returning ErrLimitReached if it does and ErrConflict if the message
+// is already pinned. The room row is locked while counting so concurrent
+// pins cannot both squeeze under the limit.
+func (db *DB) PinMessage(ctx context.Context, roomID, messageID, pinnedBy string, max int) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM rooms WHERE id = $1 FOR UPDATE`, roomID); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM pinned_messages WHERE room_id = $1
+	`, roomID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= max {
+		return ErrLimitReached
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pinned_messages (room_id, message_id, pinned_by)
+		VALUES ($1, $2, $3)
+	`, roomID, messageID, pinnedBy)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *DB) UnpinMessage(ctx context.Context, roomID, messageID string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2
+	`, roomID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetPins returns a room's pinned messages, most recently pinned first.
+func (db *DB) GetPins(ctx context.Context, roomID string) ([]models.Pin, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT m.id, m.room_id, m.user_id, m.seq, COALESCE(m.client_msg_id, ''), m.content, m.created_at,
+			   u.id, COALESCE(u.github_id, ''), u.username, u.avatar_url, u.is_admin, u.status, u.created_at,
+			   COALESCE(p.pinned_by::text, ''), p.pinned_at
+		FROM pinned_messages p
+		JOIN messages m ON m.id = p.message_id
+		JOIN users u ON u.id = m.user_id
+		WHERE p.room_id = $1
+		ORDER BY p.pinned_at DESC
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []models.Pin
+	for rows.Next() {
+		var msg models.Message
+		var user models.User
+		var pin models.Pin
+		if err := rows.Scan(
+			&msg.ID, &msg.RoomID, &msg.UserID, &msg.Seq, &msg.ClientMsgID, &msg.Content, &msg.CreatedAt,
+			&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.IsAdmin, &user.Status, &user.CreatedAt,
+			&pin.PinnedBy, &pin.PinnedAt,
+		); err != nil {
+			return nil, err
+		}
+		msg.User = &user
+		pin.Message = &msg
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
@@ -58,6 +58,160 @@ func (db *DB) Migrate(ctx context.Context) error {
 
 		CREATE INDEX IF NOT EXISTS idx_messages_room_id ON messages(room_id);
 		CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+
+		ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+		ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(64);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_msg_id
+			ON messages(user_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_messages_room_seq ON messages(room_id, seq);
+
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			last_used_at TIMESTAMP,
+			expires_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+		ALTER TABLE users ALTER COLUMN github_id DROP NOT NULL;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins INT NOT NULL DEFAULT 0;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_local_username
+			ON users(LOWER(username)) WHERE github_id IS NULL;
+
+		CREATE TABLE IF NOT EXISTS password_resets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		);
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			action VARCHAR(64) NOT NULL,
+			actor_id UUID,
+			actor_name VARCHAR(255),
+			target_type VARCHAR(32),
+			target_id VARCHAR(255),
+			ip VARCHAR(64),
+			request_id VARCHAR(128),
+			metadata JSONB,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+		CREATE TABLE IF NOT EXISTS room_settings (
+			room_id UUID PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+			slow_mode_seconds INT NOT NULL DEFAULT 0,
+			read_only BOOLEAN NOT NULL DEFAULT FALSE,
+			max_message_length INT NOT NULL DEFAULT 0,
+			link_policy VARCHAR(16) NOT NULL DEFAULT 'allow',
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS automod_rules (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			room_id UUID REFERENCES rooms(id) ON DELETE CASCADE,
+			kind VARCHAR(16) NOT NULL,
+			pattern TEXT NOT NULL DEFAULT '',
+			threshold INT NOT NULL DEFAULT 0,
+			action VARCHAR(16) NOT NULL,
+			created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_automod_rules_room_id ON automod_rules(room_id);
+
+		CREATE TABLE IF NOT EXISTS automod_hits (
+			id BIGSERIAL PRIMARY KEY,
+			rule_id UUID REFERENCES automod_rules(id) ON DELETE SET NULL,
+			room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+			kind VARCHAR(16) NOT NULL,
+			action VARCHAR(16) NOT NULL,
+			content TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_automod_hits_room_id ON automod_hits(room_id, id DESC);
+
+		CREATE TABLE IF NOT EXISTS room_mutes (
+			room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			muted_until TIMESTAMP NOT NULL,
+			reason TEXT,
+			created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			PRIMARY KEY (room_id, user_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS message_reports (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+			room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+			author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+			reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+			content TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			status VARCHAR(16) NOT NULL DEFAULT 'open',
+			resolution TEXT,
+			resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			resolved_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_message_reports_reporter ON message_reports(message_id, reporter_id);
+		CREATE INDEX IF NOT EXISTS idx_message_reports_status ON message_reports(status, created_at);
+
+		CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (blocker_id, blocked_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS pinned_messages (
+			room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			pinned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (room_id, message_id)
+		);
+
+		-- The audit log is append-only; refuse edits even from the app role.
+		CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'audit_log_no_modify') THEN
+				CREATE TRIGGER audit_log_no_modify
+					BEFORE UPDATE OR DELETE ON audit_log
+					FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
+			END IF;
+		END
+		$$;
 	`
 
 	_, err := db.Pool.Exec(ctx, schema)
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+func (db *DB) UpdateLastSeen(ctx context.Context, userID string, seenAt time.Time) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE users SET last_seen_at = $2
+		WHERE id = $1 AND (last_seen_at IS NULL OR last_seen_at < $2)
+	`, userID, seenAt)
+	return err
+}
+
+// GetLastSeen returns when the user was last connected, or nil if they
+// never have been. It returns pgx.ErrNoRows for unknown users.
+func (db *DB) GetLastSeen(ctx context.Context, userID string) (*time.Time, error) {
+	var seenAt *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT last_seen_at FROM users WHERE id = $1
+	`, userID).Scan(&seenAt)
+	if err != nil {
+		return nil, err
+	}
+	return seenAt, nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned  = "actioned"
+)
+
+const reportColumns = `
+	r.id, COALESCE(r.message_id::text, ''), r.room_id, COALESCE(r.author_id::text, ''),
+	COALESCE(a.username, ''), COALESCE(r.reporter_id::text, ''), COALESCE(p.username, ''),
+	r.content, r.reason, r.status, COALESCE(r.resolution, ''),
+	COALESCE(r.resolved_by::text, ''), r.resolved_at, r.created_at`
+
+const reportJoins = `
+	FROM message_reports r
+	LEFT JOIN users a ON a.id = r.author_id
+	LEFT JOIN users p ON p.id = r.reporter_id`
+
+func scanReport(row pgx.Row, report *models.MessageReport) error {
+	return row.Scan(
+		&report.ID, &report.MessageID, &report.RoomID, &report.AuthorID,
+		&report.AuthorName, &report.ReporterID, &report.ReporterName,
+		&report.Content, &report.Reason, &report.Status, &report.Resolution,
+		&report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt,
+	)
+}
+
+// CreateReport reports msg, keeping a copy of its author and content. An
+// empty reporterID files it on behalf of auto-moderation. It returns
+// ErrConflict if the reporter already reported the message.
+func (db *DB) CreateReport(ctx context.Context, msg *models.Message, reporterID, reason string) (*models.MessageReport, error) {
+	var id string
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO message_reports (message_id, room_id, author_id, reporter_id, content, reason)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6)
+		RETURNING id
+	`, msg.ID, msg.RoomID, msg.UserID, reporterID, msg.Content, reason).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetReport(ctx, id)
+}
+
+func (db *DB) GetReport(ctx context.Context, id string) (*models.MessageReport, error) {
+	var report models.MessageReport
+	err := scanReport(db.Pool.QueryRow(ctx, `SELECT `+reportColumns+reportJoins+` WHERE r.id = $1`, id), &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetReports returns reports oldest first, so the queue is worked in
+// order: for one room or, when roomID is empty, every room, and with the
+// given status or, when status is empty, any.
+func (db *DB) GetReports(ctx context.Context, roomID, status string, limit, offset int) ([]models.MessageReport, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+reportColumns+reportJoins+`
+		WHERE ($1 = '' OR r.room_id::text = $1) AND ($2 = '' OR r.status = $2)
+		ORDER BY r.created_at, r.id
+		LIMIT $3 OFFSET $4
+	`, roomID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.MessageReport
+	for rows.Next() {
+		var report models.MessageReport
+		if err := scanReport(rows, &report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// SetReportStatus moves a report from one status to another, returning
+// pgx.ErrNoRows if it is no longer in the from status.
+func (db *DB) SetReportStatus(ctx context.Context, id, from, to, resolution, resolvedBy string) (*models.MessageReport, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE message_reports SET
+			status = $3,
+			resolution = NULLIF($4, ''),
+			resolved_by = CASE WHEN $3 = 'open' THEN NULL ELSE NULLIF($5, '')::uuid END,
+			resolved_at = CASE WHEN $3 = 'open' THEN NULL ELSE NOW() END
+		WHERE id = $1 AND status = $2
+	`, id, from, to, resolution, resolvedBy)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return db.GetReport(ctx, id)
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// GetRoomSettings returns a room's settings, with defaults for rooms that
+// never had any saved. It returns pgx.ErrNoRows if the room does not exist.
+func (db *DB) GetRoomSettings(ctx context.Context, roomID string) (*models.RoomSettings, error) {
+	var s models.RoomSettings
+	err := db.Pool.QueryRow(ctx, `
+		SELECT r.id, COALESCE(r.created_by::text, ''),
+			   COALESCE(s.slow_mode_seconds, 0), COALESCE(s.read_only, FALSE),
+			   COALESCE(s.max_message_length, 0), COALESCE(s.link_policy, 'allow')
+		FROM rooms r
+		LEFT JOIN room_settings s ON s.room_id = r.id
+		WHERE r.id = $1
+	`, roomID).Scan(&s.RoomID, &s.OwnerID, &s.SlowModeSeconds, &s.ReadOnly, &s.MaxMessageLength, &s.LinkPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *DB) UpdateRoomSettings(ctx context.Context, s *models.RoomSettings) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO room_settings (room_id, slow_mode_seconds, read_only, max_message_length, link_policy)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id) DO UPDATE SET
+			slow_mode_seconds = EXCLUDED.slow_mode_seconds,
+			read_only = EXCLUDED.read_only,
+			max_message_length = EXCLUDED.max_message_length,
+			link_policy = EXCLUDED.link_policy,
+			updated_at = NOW()
+	`, s.RoomID, s.SlowModeSeconds, s.ReadOnly, s.MaxMessageLength, s.LinkPolicy)
+	return err
+}
@@ -53,9 +53,36 @@ func (db *DB) GetRoomByID(ctx context.Context, id string) (*models.Room, error)
 	return &room, nil
 }
 
-func (db *DB) DeleteRoom(ctx context.Context, id, userID string) error {
-	_, err := db.Pool.Exec(ctx, `
+func (db *DB) DeleteRoom(ctx context.Context, id, userID string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
 		DELETE FROM rooms WHERE id = $1 AND created_by = $2
 	`, id, userID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteRoomByID deletes a room regardless of owner, for administrators.
+func (db *DB) DeleteRoomByID(ctx context.Context, id string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM rooms WHERE id = $1
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (db *DB) TransferRoom(ctx context.Context, id, newOwnerID string) (*models.Room, error) {
+	var room models.Room
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE rooms SET created_by = $2
+		WHERE id = $1
+		RETURNING id, name, created_by, created_at
+	`, id, newOwnerID).Scan(&room.ID, &room.Name, &room.CreatedBy, &room.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
 }
@@ -2,22 +2,40 @@ package database
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusBanned   = "banned"
+)
+
+// userColumns is the column list scanUser expects, for queries selecting a
+// whole user.
+const userColumns = `id, COALESCE(github_id, ''), username, avatar_url, is_admin, status, created_at, token_version`
+
+func scanUser(row pgx.Row, user *models.User, extra ...interface{}) error {
+	dest := append([]interface{}{
+		&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.IsAdmin, &user.Status, &user.CreatedAt, &user.TokenVersion,
+	}, extra...)
+	return row.Scan(dest...)
+}
+
 func (db *DB) CreateUser(ctx context.Context, githubID, username, avatarURL string) (*models.User, error) {
 	var user models.User
-	err := db.Pool.QueryRow(ctx, `
+	err := scanUser(db.Pool.QueryRow(ctx, `
 		INSERT INTO users (github_id, username, avatar_url)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (github_id) DO UPDATE SET
 			username = EXCLUDED.username,
 			avatar_url = EXCLUDED.avatar_url
-		RETURNING id, github_id, username, avatar_url, created_at
-	`, githubID, username, avatarURL).Scan(
-		&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.CreatedAt,
-	)
+		RETURNING `+userColumns, githubID, username, avatarURL), &user)
 	if err != nil {
 		return nil, err
 	}
@@ -26,10 +44,10 @@ func (db *DB) CreateUser(ctx context.Context, githubID, username, avatarURL stri
 
 func (db *DB) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	var user models.User
-	err := db.Pool.QueryRow(ctx, `
-		SELECT id, github_id, username, avatar_url, created_at
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		SELECT `+userColumns+`
 		FROM users WHERE id = $1
-	`, id).Scan(&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.CreatedAt)
+	`, id), &user)
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +56,196 @@ func (db *DB) GetUserByID(ctx context.Context, id string) (*models.User, error)
 
 func (db *DB) GetUserByGithubID(ctx context.Context, githubID string) (*models.User, error) {
 	var user models.User
-	err := db.Pool.QueryRow(ctx, `
-		SELECT id, github_id, username, avatar_url, created_at
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		SELECT `+userColumns+`
 		FROM users WHERE github_id = $1
-	`, githubID).Scan(&user.ID, &user.GithubID, &user.Username, &user.AvatarURL, &user.CreatedAt)
+	`, githubID), &user)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+// LocalCredentials is the password login state of a local account.
+type LocalCredentials struct {
+	User         *models.User
+	PasswordHash string
+	LockedUntil  *time.Time
+}
+
+func (db *DB) CreateLocalUser(ctx context.Context, username, passwordHash string) (*models.User, error) {
+	var user models.User
+	// GitHub accounts sit outside the local username index, so the insert
+	// checks every account for the name itself.
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		INSERT INTO users (username, avatar_url, password_hash)
+		SELECT $1::text, '', $2
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER($1::text))
+		RETURNING `+userColumns, username, passwordHash), &user)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || isUniqueViolation(err) {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *DB) GetLocalCredentials(ctx context.Context, username string) (*LocalCredentials, error) {
+	var user models.User
+	creds := LocalCredentials{User: &user}
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		SELECT `+userColumns+`, password_hash, locked_until
+		FROM users WHERE github_id IS NULL AND LOWER(username) = LOWER($1) AND password_hash IS NOT NULL
+	`, username), &user, &creds.PasswordHash, &creds.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+func (db *DB) GetLocalCredentialsByID(ctx context.Context, userID string) (*LocalCredentials, error) {
+	var user models.User
+	creds := LocalCredentials{User: &user}
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		SELECT `+userColumns+`, password_hash, locked_until
+		FROM users WHERE id = $1 AND password_hash IS NOT NULL
+	`, userID), &user, &creds.PasswordHash, &creds.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+func (db *DB) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	var hash string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT password_hash FROM users WHERE id = $1 AND password_hash IS NOT NULL
+	`, userID).Scan(&hash)
+	return hash, err
+}
+
+// ChangePassword sets a new password and bumps the token version, so every
+// session token issued before the change stops authenticating.
+func (db *DB) ChangePassword(ctx context.Context, userID, passwordHash string) (*models.User, error) {
+	var user models.User
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		UPDATE users SET password_hash = $2, failed_logins = 0, locked_until = NULL,
+			token_version = token_version + 1
+		WHERE id = $1 AND password_hash IS NOT NULL
+		RETURNING `+userColumns, userID, passwordHash), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *DB) SetPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE users SET password_hash = $2, failed_logins = 0, locked_until = NULL
+		WHERE id = $1
+	`, userID, passwordHash)
+	return err
+}
+
+// RecordFailedLogin counts a failed password attempt and locks the account
+// for lockout once maxAttempts consecutive failures are reached. It returns
+// the lock expiry when the account became locked.
+func (db *DB) RecordFailedLogin(ctx context.Context, userID string, maxAttempts int, lockout time.Duration) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE users SET
+			failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END,
+			locked_until = CASE WHEN failed_logins + 1 >= $2 THEN NOW() + $3 * INTERVAL '1 second' ELSE locked_until END
+		WHERE id = $1
+		RETURNING locked_until
+	`, userID, maxAttempts, lockout.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil != nil && lockedUntil.Before(time.Now()) {
+		return nil, nil
+	}
+	return lockedUntil, nil
+}
+
+func (db *DB) ResetFailedLogins(ctx context.Context, userID string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1
+	`, userID)
+	return err
+}
+
+// SearchUsers lists users whose username contains query, newest first. An
+// empty query lists everyone.
+func (db *DB) SearchUsers(ctx context.Context, query string, limit, offset int) ([]models.User, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE $1 = '' OR username ILIKE '%' || $1 || '%'
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (db *DB) SetUserStatus(ctx context.Context, userID, status, reason string) (*models.User, error) {
+	var user models.User
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		UPDATE users SET status = $2, status_reason = NULLIF($3, '')
+		WHERE id = $1
+		RETURNING `+userColumns, userID, status, reason), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *DB) SetUserAdmin(ctx context.Context, userID string, isAdmin bool) (*models.User, error) {
+	var user models.User
+	err := scanUser(db.Pool.QueryRow(ctx, `
+		UPDATE users SET is_admin = $2
+		WHERE id = $1
+		RETURNING `+userColumns, userID, isAdmin), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// BootstrapAdmins grants the admin flag to existing accounts named in
+// ADMIN_USERS by stable ID: "github:<GitHub user ID>" or "user:<user ID>".
+// Usernames are never trusted, since anyone can register a free one.
+func (db *DB) BootstrapAdmins(ctx context.Context, admins []string) error {
+	for _, admin := range admins {
+		kind, id, ok := strings.Cut(admin, ":")
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch kind {
+		case "github":
+			_, err = db.Pool.Exec(ctx, `UPDATE users SET is_admin = TRUE WHERE github_id = $1`, id)
+		case "user":
+			_, err = db.Pool.Exec(ctx, `UPDATE users SET is_admin = TRUE WHERE id::text = LOWER($1)`, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
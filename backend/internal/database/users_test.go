@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func randomName(t *testing.T) string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return "user" + hex.EncodeToString(b)
+}
+
+func TestCreateLocalUserRejectsGithubUsername(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	name := randomName(t)
+
+	gh, err := db.CreateUser(ctx, "gh-"+name, name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, gh.ID) })
+
+	_, err = db.CreateLocalUser(ctx, strings.ToUpper(name), "hash")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreateLocalUser with a GitHub user's name: err = %v, want ErrConflict", err)
+	}
+}
+
+func TestCreateLocalUserRejectsLocalUsername(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	name := randomName(t)
+
+	user, err := db.CreateLocalUser(ctx, name, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, user.ID) })
+
+	_, err = db.CreateLocalUser(ctx, strings.ToUpper(name), "hash")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("second CreateLocalUser: err = %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/auth"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+type AdminHandler struct {
+	DB    *database.DB
+	Hub   *ws.Hub
+	Auth  *auth.Authenticator
+	Audit *audit.Logger
+}
+
+type UpdateUserStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type UpdateUserAdminRequest struct {
+	IsAdmin bool `json:"is_admin"`
+}
+
+type TransferRoomRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type AnnouncementRequest struct {
+	Message string `json:"message"`
+}
+
+func NewAdminHandler(db *database.DB, hub *ws.Hub, authn *auth.Authenticator, auditLog *audit.Logger) *AdminHandler {
+	return &AdminHandler{DB: db, Hub: hub, Auth: authn, Audit: auditLog}
+}
+
+func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r, 50, 200)
+
+	users, err := h.DB.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+
+	if users == nil {
+		users = []models.User{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// UpdateUserStatus disables, bans or reactivates an account. Disabling or
+// banning also closes the user's live WebSocket connections.
+func (h *AdminHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateUserStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Status {
+	case database.UserStatusActive, database.UserStatusDisabled, database.UserStatusBanned:
+	default:
+		http.Error(w, "Status must be active, disabled or banned", http.StatusBadRequest)
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	if userID == admin.ID && req.Status != database.UserStatusActive {
+		http.Error(w, "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	user, err := setUserStatus(r, h.DB, h.Auth, h.Hub, h.Audit, userID, req.Status, req.Reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// setUserStatus changes an account's status, closing its live connections
+// unless it is active, and audits the change.
+func setUserStatus(r *http.Request, db *database.DB, authn *auth.Authenticator, hub *ws.Hub, auditLog *audit.Logger, userID, status, reason string) (*models.User, error) {
+	user, err := db.SetUserStatus(r.Context(), userID, status, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	authn.Forget(user.ID)
+	var disconnected int
+	if user.Status != database.UserStatusActive {
+		disconnected = hub.DisconnectUser(user.ID, "account "+user.Status)
+	}
+
+	auditLog.Record(r, audit.Event{
+		Action:     audit.ActionUserStatus,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Metadata: map[string]interface{}{
+			"status":       user.Status,
+			"reason":       reason,
+			"disconnected": disconnected,
+		},
+	})
+	return user, nil
+}
+
+func (h *AdminHandler) UpdateUserAdmin(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateUserAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	if userID == admin.ID && !req.IsAdmin {
+		http.Error(w, "You cannot remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.DB.SetUserAdmin(r.Context(), userID, req.IsAdmin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	h.Auth.Forget(user.ID)
+	refreshed := h.Hub.RefreshUser(user.ID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionUserAdmin,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Metadata:   map[string]interface{}{"is_admin": user.IsAdmin, "reconnected": refreshed},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+
+	deleted, err := h.DB.DeleteRoomByID(r.Context(), roomID)
+	if err != nil {
+		http.Error(w, "Failed to delete room", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	h.Hub.CloseRoom(roomID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionAdminRoomDelete,
+		TargetType: audit.TargetRoom,
+		TargetID:   roomID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) TransferRoom(w http.ResponseWriter, r *http.Request) {
+	var req TransferRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.DB.GetUserByID(r.Context(), req.UserID); err != nil {
+		http.Error(w, "New owner not found", http.StatusBadRequest)
+		return
+	}
+
+	roomID := chi.URLParam(r, "id")
+	previous, err := h.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	room, err := h.DB.TransferRoom(r.Context(), roomID, req.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to transfer room", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.ForgetRoomSettings(room.ID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionAdminRoomTransfer,
+		TargetType: audit.TargetRoom,
+		TargetID:   room.ID,
+		Metadata:   map[string]interface{}{"from": previous.CreatedBy, "to": room.CreatedBy},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(room)
+}
+
+func (h *AdminHandler) GetConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Hub.ConnectionStats())
+}
+
+func (h *AdminHandler) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Message == "" {
+		http.Error(w, "Message is required", http.StatusBadRequest)
+		return
+	}
+
+	h.Hub.Announce(req.Message)
+
+	h.Audit.Record(r, audit.Event{
+		Action:   audit.ActionAnnouncement,
+		Metadata: map[string]interface{}{"message": req.Message},
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pagination reads limit and offset query parameters, clamping limit to
+// max.
+func pagination(r *http.Request, defaultLimit, max int) (limit, offset int) {
+	limit = defaultLimit
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > max {
+		limit = max
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	return limit, offset
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,15 +9,22 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/auth"
 	"github.com/ilhammramadhan/gabble/internal/config"
 	"github.com/ilhammramadhan/gabble/internal/database"
 	"github.com/ilhammramadhan/gabble/internal/middleware"
 	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
 )
 
 type AuthHandler struct {
 	DB     *database.DB
 	Config *config.Config
+	Keys   *auth.KeySet
+	Auth   *auth.Authenticator
+	Hub    *ws.Hub
+	Audit  *audit.Logger
 }
 
 type GithubUser struct {
@@ -36,8 +44,8 @@ type AuthResponse struct {
 	User  *models.User `json:"user"`
 }
 
-func NewAuthHandler(db *database.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{DB: db, Config: cfg}
+func NewAuthHandler(db *database.DB, cfg *config.Config, keys *auth.KeySet, authn *auth.Authenticator, hub *ws.Hub, auditLog *audit.Logger) *AuthHandler {
+	return &AuthHandler{DB: db, Config: cfg, Keys: keys, Auth: authn, Hub: hub, Audit: auditLog}
 }
 
 func (h *AuthHandler) GithubLogin(w http.ResponseWriter, r *http.Request) {
@@ -90,12 +98,27 @@ func (h *AuthHandler) GithubCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.checkLogin(r.Context(), user); err != nil {
+		http.Redirect(w, r, h.Config.FrontendURL+"?error=account_disabled", http.StatusTemporaryRedirect)
+		return
+	}
+
 	token, err := h.generateJWT(user)
 	if err != nil {
 		http.Redirect(w, r, h.Config.FrontendURL+"?error=jwt_generation_failed", http.StatusTemporaryRedirect)
 		return
 	}
 
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionLogin,
+		Actor:      user,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Metadata:   map[string]interface{}{"provider": "github"},
+	})
+
+	h.setSessionCookie(w, token, 7*24*time.Hour)
+
 	// Redirect to frontend with token
 	http.Redirect(w, r, h.Config.FrontendURL+"?token="+token, http.StatusTemporaryRedirect)
 }
@@ -111,6 +134,57 @@ func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.setSessionCookie(w, "", -1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setSessionCookie stores the token in an HttpOnly cookie for clients that
+// prefer not to keep it in script-accessible storage. A negative maxAge
+// clears it.
+func (h *AuthHandler) setSessionCookie(w http.ResponseWriter, token string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     auth.CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	// The frontend and API live on different sites in production, which
+	// requires SameSite=None and therefore Secure.
+	if h.Config.IsProduction() {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.Keys.JWKS())
+}
+
+// checkLogin refuses disabled accounts and grants the admin flag to
+// accounts listed in ADMIN_USERS on their first login.
+func (h *AuthHandler) checkLogin(ctx context.Context, user *models.User) error {
+	if user.Status != database.UserStatusActive {
+		return auth.ErrAccountDisabled
+	}
+
+	if !user.IsAdmin && h.Config.IsAdminAccount(user.ID, user.GithubID) {
+		if _, err := h.DB.SetUserAdmin(ctx, user.ID, true); err != nil {
+			return err
+		}
+		user.IsAdmin = true
+	}
+	return nil
+}
+
 func (h *AuthHandler) exchangeCodeForToken(code string) (string, error) {
 	req, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", nil)
 	if err != nil {
@@ -169,9 +243,9 @@ func (h *AuthHandler) getGithubUser(accessToken string) (*GithubUser, error) {
 func (h *AuthHandler) generateJWT(user *models.User) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
+		"tv":      user.TokenVersion,
 		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.Config.JWTSecret))
+	return h.Keys.Sign(claims)
 }
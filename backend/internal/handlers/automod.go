@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/automod"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+)
+
+// AutomodHandler manages auto-moderation rules and lists their hits. Under
+// /api/rooms/{id} it works on that room's rules, for the room's owner or an
+// admin; under /api/admin it works on the server-wide rules.
+type AutomodHandler struct {
+	DB    *database.DB
+	Hub   *ws.Hub
+	Audit *audit.Logger
+}
+
+type CreateAutomodRuleRequest struct {
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern"`
+	Threshold int    `json:"threshold"`
+	Action    string `json:"action"`
+}
+
+func NewAutomodHandler(db *database.DB, hub *ws.Hub, auditLog *audit.Logger) *AutomodHandler {
+	return &AutomodHandler{DB: db, Hub: hub, Audit: auditLog}
+}
+
+func (h *AutomodHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	rules, err := h.DB.GetAutomodRules(r.Context(), roomID)
+	if err != nil {
+		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = []models.AutomodRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (h *AutomodHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+	user, _ := r.Context().Value(middleware.UserContextKey).(*models.User)
+
+	var req CreateAutomodRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule := &models.AutomodRule{
+		RoomID:    roomID,
+		Kind:      req.Kind,
+		Pattern:   req.Pattern,
+		Threshold: req.Threshold,
+		Action:    req.Action,
+	}
+	if user != nil {
+		rule.CreatedBy = user.ID
+	}
+	if err := automod.Validate(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.CreateAutomodRule(r.Context(), rule); err != nil {
+		http.Error(w, "Failed to create rule", http.StatusInternalServerError)
+		return
+	}
+	h.reload(r, roomID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionAutomodRuleCreate,
+		TargetType: audit.TargetRule,
+		TargetID:   rule.ID,
+		Metadata: map[string]interface{}{
+			"room_id":   roomID,
+			"kind":      rule.Kind,
+			"pattern":   rule.Pattern,
+			"threshold": rule.Threshold,
+			"action":    rule.Action,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *AutomodHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	ruleID := chi.URLParam(r, "ruleID")
+	deleted, err := h.DB.DeleteAutomodRule(r.Context(), ruleID, roomID)
+	if err != nil {
+		http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	h.reload(r, roomID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionAutomodRuleDelete,
+		TargetType: audit.TargetRule,
+		TargetID:   ruleID,
+		Metadata:   map[string]interface{}{"room_id": roomID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetHits lists what the rules matched, newest first: for one room, or
+// under /api/admin for every room.
+func (h *AutomodHandler) GetHits(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+	limit, offset := pagination(r, 50, 200)
+
+	hits, err := h.DB.GetAutomodHits(r.Context(), roomID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get automod hits", http.StatusInternalServerError)
+		return
+	}
+
+	if hits == nil {
+		hits = []models.AutomodHit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
+
+// reload applies a saved rule change to the hub.
+func (h *AutomodHandler) reload(r *http.Request, roomID string) {
+	if err := h.Hub.ReloadAutomodRules(r.Context(), roomID); err != nil {
+		log.Printf("error reloading automod rules: %v", err)
+	}
+}
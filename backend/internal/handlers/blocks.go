@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+)
+
+// BlockHandler manages the users someone has blocked. Blocked users'
+// messages and typing indicators are hidden from the blocker, both in
+// history and live.
+type BlockHandler struct {
+	DB  *database.DB
+	Hub *ws.Hub
+}
+
+type BlockUserRequest struct {
+	UserID string `json:"user_id"`
+}
+
+func NewBlockHandler(db *database.DB, hub *ws.Hub) *BlockHandler {
+	return &BlockHandler{DB: db, Hub: hub}
+}
+
+func (h *BlockHandler) GetBlocks(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	blocks, err := h.DB.GetBlocks(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get blocks", http.StatusInternalServerError)
+		return
+	}
+
+	if blocks == nil {
+		blocks = []models.Block{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocks)
+}
+
+func (h *BlockHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req BlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == user.ID {
+		http.Error(w, "You cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	blocked, err := h.DB.GetUserByID(r.Context(), req.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.BlockUser(r.Context(), user.ID, blocked.ID); err != nil {
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.SetBlocked(user.ID, blocked.ID, true)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BlockHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	blockedID := chi.URLParam(r, "id")
+	unblocked, err := h.DB.UnblockUser(r.Context(), user.ID, blockedID)
+	if err != nil {
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+	if !unblocked {
+		http.Error(w, "User is not blocked", http.StatusNotFound)
+		return
+	}
+	h.Hub.SetBlocked(user.ID, blockedID, false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/auth"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+)
+
+// EventsHandler serves the hub's events over Server-Sent Events, with
+// sending done over REST, for clients that cannot hold a WebSocket open.
+type EventsHandler struct {
+	Hub  *ws.Hub
+	Auth *auth.Authenticator
+}
+
+type SendMessageRequest struct {
+	Content     string `json:"content"`
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+func NewEventsHandler(hub *ws.Hub, authn *auth.Authenticator) *EventsHandler {
+	return &EventsHandler{Hub: hub, Auth: authn}
+}
+
+// Stream joins the room in the "room" query parameter, subscribes to the
+// comma separated "rooms", and streams their events until the client goes
+// away.
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if h.Hub.ShuttingDown() {
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	// EventSource cannot set headers, so the token may be in the query.
+	principal, err := h.Auth.Authenticate(r, true)
+	if err != nil {
+		auth.WriteError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	room := query.Get("room")
+	var rooms []string
+	for _, id := range strings.Split(query.Get("rooms"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			rooms = append(rooms, id)
+		}
+	}
+	if room == "" && len(rooms) == 0 {
+		http.Error(w, "At least one room is required", http.StatusBadRequest)
+		return
+	}
+
+	// Browsers send Last-Event-ID when they reconnect; the query parameter
+	// lets a fresh EventSource resume too.
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	var after int64
+	if lastEventID != "" {
+		if after, err = strconv.ParseInt(lastEventID, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ticket, err := h.Hub.Admit(principal.User.ID, middleware.ClientIP(r))
+	if err != nil {
+		writeAdmissionError(w, err)
+		return
+	}
+
+	client := ws.NewClient(h.Hub, ws.NewSSETransport(r.Context(), w, after), principal.User)
+	if !h.Hub.Attach(client, ticket) {
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.Hub.Subscribe(client, rooms...); err != nil {
+		h.Hub.Detach(client)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if room != "" {
+		if err := h.Hub.Join(client, room); err != nil {
+			h.Hub.Detach(client)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	client.Run()
+}
+
+// SendMessage posts a message to a room, as send_message does over a
+// WebSocket. Retrying with the same client_msg_id returns the original
+// message with 200 instead of 201.
+func (h *EventsHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if ok, retryAfter := h.Hub.AllowEvent(user.ID, ws.EventSendMessage); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+		return
+	}
+
+	var req SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, created, err := h.Hub.SendMessage(r.Context(), user, chi.URLParam(r, "id"), req.Content, req.ClientMsgID)
+	var rejected *ws.SendError
+	if errors.As(err, &rejected) {
+		status := http.StatusBadRequest
+		switch {
+		case rejected.RetryAfter > 0:
+			w.Header().Set("Retry-After", strconv.Itoa(int((rejected.RetryAfter+time.Second-1)/time.Second)))
+			status = http.StatusTooManyRequests
+		case rejected.Code == ws.ErrCodeRoomNotFound:
+			status = http.StatusNotFound
+		case rejected.Code == ws.ErrCodeReadOnly:
+			status = http.StatusForbidden
+		}
+		http.Error(w, rejected.Message, status)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+		return
+	}
+	msg.User = user
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(msg)
+}
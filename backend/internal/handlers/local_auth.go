@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/auth"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type PasswordResetResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ProvidersResponse struct {
+	Github       bool `json:"github"`
+	Local        bool `json:"local"`
+	Registration bool `json:"registration"`
+}
+
+func (h *AuthHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProvidersResponse{
+		Github:       h.Config.GithubAuthEnabled(),
+		Local:        h.Config.LocalAuthEnabled(),
+		Registration: h.Config.LocalAuthEnabled() && h.Config.LocalRegistration,
+	})
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	if !h.Config.LocalRegistration {
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !usernamePattern.MatchString(req.Username) {
+		http.Error(w, "Username must be 3-32 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password, h.Config.PasswordHashAlgorithm)
+	if err != nil {
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.DB.CreateLocalUser(r.Context(), req.Username, hash)
+	if errors.Is(err, database.ErrConflict) {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionRegister,
+		Actor:      user,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+	})
+
+	h.respondWithToken(w, user, http.StatusCreated)
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := h.DB.GetLocalCredentials(r.Context(), req.Username)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+		// Hash anyway so unknown usernames take as long as wrong passwords.
+		auth.HashPassword(req.Password, h.Config.PasswordHashAlgorithm)
+		h.recordLoginFailure(r, nil, req.Username, "unknown_user")
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	if creds.LockedUntil != nil && creds.LockedUntil.After(time.Now()) {
+		h.recordLoginFailure(r, creds.User, req.Username, "locked")
+		writeLocked(w, *creds.LockedUntil)
+		return
+	}
+
+	ok, rehash, err := auth.VerifyPassword(creds.PasswordHash, req.Password, h.Config.PasswordHashAlgorithm)
+	if err != nil {
+		log.Printf("error verifying password for user %s: %v", creds.User.ID, err)
+	}
+	if !ok {
+		lockedUntil, err := h.DB.RecordFailedLogin(r.Context(), creds.User.ID, h.Config.LoginMaxAttempts, h.Config.LoginLockoutDuration)
+		if err != nil {
+			log.Printf("error recording failed login: %v", err)
+		}
+		reason := "bad_password"
+		if lockedUntil != nil {
+			reason = "bad_password_locked"
+		}
+		h.recordLoginFailure(r, creds.User, req.Username, reason)
+		if lockedUntil != nil {
+			writeLocked(w, *lockedUntil)
+			return
+		}
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	// Only say the account is disabled to someone who knows its password.
+	if creds.User.Status != database.UserStatusActive {
+		h.recordLoginFailure(r, creds.User, req.Username, "account_"+creds.User.Status)
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	if rehash {
+		if hash, err := auth.HashPassword(req.Password, h.Config.PasswordHashAlgorithm); err == nil {
+			h.DB.SetPasswordHash(r.Context(), creds.User.ID, hash)
+		}
+	} else {
+		h.DB.ResetFailedLogins(r.Context(), creds.User.ID)
+	}
+
+	if err := h.checkLogin(r.Context(), creds.User); err != nil {
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionLogin,
+		Actor:      creds.User,
+		TargetType: audit.TargetUser,
+		TargetID:   creds.User.ID,
+		Metadata:   map[string]interface{}{"provider": "local"},
+	})
+
+	h.respondWithToken(w, creds.User, http.StatusOK)
+}
+
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := h.DB.GetLocalCredentialsByID(r.Context(), user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Account has no password", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	// A wrong current password counts towards the same lockout as a failed
+	// login, so a stolen session cannot be used to guess the password.
+	if creds.LockedUntil != nil && creds.LockedUntil.After(time.Now()) {
+		h.recordLoginFailure(r, user, user.Username, "locked")
+		writeLocked(w, *creds.LockedUntil)
+		return
+	}
+
+	if ok, _, _ := auth.VerifyPassword(creds.PasswordHash, req.CurrentPassword, h.Config.PasswordHashAlgorithm); !ok {
+		lockedUntil, err := h.DB.RecordFailedLogin(r.Context(), user.ID, h.Config.LoginMaxAttempts, h.Config.LoginLockoutDuration)
+		if err != nil {
+			log.Printf("error recording failed login: %v", err)
+		}
+		reason := "bad_current_password"
+		if lockedUntil != nil {
+			reason = "bad_current_password_locked"
+		}
+		h.recordLoginFailure(r, user, user.Username, reason)
+		if lockedUntil != nil {
+			writeLocked(w, *lockedUntil)
+			return
+		}
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword, h.Config.PasswordHashAlgorithm)
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.DB.ChangePassword(r.Context(), user.ID, hash)
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	h.revokeSessions(updated.ID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionPasswordChange,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+	})
+
+	// The caller's own token was just revoked, so hand it a fresh one.
+	h.respondWithToken(w, updated, http.StatusOK)
+}
+
+// CreatePasswordReset issues a single-use reset token for a local account.
+// An administrator hands the token to the user out of band, since
+// self-hosted installs may have no mail delivery.
+func (h *AuthHandler) CreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	if _, err := h.DB.GetPasswordHash(r.Context(), userID); err != nil {
+		http.Error(w, "Local account not found", http.StatusNotFound)
+		return
+	}
+
+	token, hash, err := auth.NewResetToken()
+	if err != nil {
+		http.Error(w, "Failed to create reset token", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(h.Config.PasswordResetTTL)
+	if err := h.DB.CreatePasswordReset(r.Context(), userID, admin.ID, hash, expiresAt); err != nil {
+		http.Error(w, "Failed to create reset token", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionPasswordResetIssue,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PasswordResetResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword, h.Config.PasswordHashAlgorithm)
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := h.DB.UsePasswordReset(r.Context(), auth.HashAPIToken(req.Token), hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	h.revokeSessions(userID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionPasswordReset,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) respondWithToken(w http.ResponseWriter, user *models.User, status int) {
+	token, err := h.generateJWT(user)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	h.setSessionCookie(w, token, 7*24*time.Hour)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AuthResponse{Token: token, User: user})
+}
+
+// revokeSessions makes a token version bump take effect at once: the cached
+// user still holds the old version, and live connections were authenticated
+// with the old token, so they are closed to reconnect and authenticate again.
+func (h *AuthHandler) revokeSessions(userID string) {
+	h.Auth.Forget(userID)
+	h.Hub.RefreshUser(userID)
+}
+
+func (h *AuthHandler) recordLoginFailure(r *http.Request, user *models.User, username, reason string) {
+	event := audit.Event{
+		Action:   audit.ActionLoginFailed,
+		Metadata: map[string]interface{}{"provider": "local", "username": username, "reason": reason},
+	}
+	if user != nil {
+		event.TargetType = audit.TargetUser
+		event.TargetID = user.ID
+	}
+	h.Audit.Record(r, event)
+}
+
+func writeLocked(w http.ResponseWriter, until time.Time) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+}
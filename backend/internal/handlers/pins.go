@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/config"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+)
+
+// PinHandler serves a room's pinned messages. Anyone can list them; the
+// room's owner and admins pin and unpin, and every change is pushed to the
+// room as pins_updated.
+type PinHandler struct {
+	DB     *database.DB
+	Hub    *ws.Hub
+	Config *config.Config
+	Audit  *audit.Logger
+}
+
+type PinMessageRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+func NewPinHandler(db *database.DB, hub *ws.Hub, cfg *config.Config, auditLog *audit.Logger) *PinHandler {
+	return &PinHandler{DB: db, Hub: hub, Config: cfg, Audit: auditLog}
+}
+
+func (h *PinHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+	if _, err := h.DB.GetRoomByID(r.Context(), roomID); err != nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	pins, err := h.DB.GetPins(r.Context(), roomID)
+	if err != nil {
+		http.Error(w, "Failed to get pins", http.StatusInternalServerError)
+		return
+	}
+
+	if pins == nil {
+		pins = []models.Pin{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pins)
+}
+
+func (h *PinHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	settings, user, ok := requireRoomModerator(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	var req PinMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.DB.GetMessageByID(r.Context(), req.MessageID)
+	if err != nil || msg.RoomID != settings.RoomID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.DB.PinMessage(r.Context(), msg.RoomID, msg.ID, user.ID, h.Config.MaxPinsPerRoom)
+	if errors.Is(err, database.ErrConflict) {
+		http.Error(w, "Message is already pinned", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, database.ErrLimitReached) {
+		http.Error(w, fmt.Sprintf("Rooms can have at most %d pinned messages", h.Config.MaxPinsPerRoom), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to pin message", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionMessagePin,
+		TargetType: audit.TargetMessage,
+		TargetID:   msg.ID,
+		Metadata:   map[string]interface{}{"room_id": msg.RoomID},
+	})
+
+	pins, err := h.Hub.PinsUpdated(r.Context(), msg.RoomID)
+	if err != nil {
+		http.Error(w, "Failed to get pins", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pins)
+}
+
+func (h *PinHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	settings, _, ok := requireRoomModerator(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	messageID := chi.URLParam(r, "messageID")
+	unpinned, err := h.DB.UnpinMessage(r.Context(), settings.RoomID, messageID)
+	if err != nil {
+		http.Error(w, "Failed to unpin message", http.StatusInternalServerError)
+		return
+	}
+	if !unpinned {
+		http.Error(w, "Message is not pinned", http.StatusNotFound)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionMessageUnpin,
+		TargetType: audit.TargetMessage,
+		TargetID:   messageID,
+		Metadata:   map[string]interface{}{"room_id": settings.RoomID},
+	})
+
+	if _, err := h.Hub.PinsUpdated(r.Context(), settings.RoomID); err != nil {
+		http.Error(w, "Failed to get pins", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+)
+
+// PollHandler serves long-poll sessions for clients that can use neither
+// WebSockets nor SSE. Sessions are identified by the "session" query
+// parameter and only usable by the user that created them.
+type PollHandler struct {
+	Hub *ws.Hub
+
+	// sessions maps session IDs to their *ws.Client.
+	sessions sync.Map
+}
+
+type PollSessionResponse struct {
+	SessionID string `json:"session_id"`
+}
+
+func NewPollHandler(hub *ws.Hub) *PollHandler {
+	return &PollHandler{Hub: hub}
+}
+
+func (h *PollHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if h.Hub.ShuttingDown() {
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	ticket, err := h.Hub.Admit(user.ID, middleware.ClientIP(r))
+	if err != nil {
+		writeAdmissionError(w, err)
+		return
+	}
+
+	transport, err := ws.NewPollTransport()
+	if err != nil {
+		ticket.Release()
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	client := ws.NewClient(h.Hub, transport, user)
+	if !h.Hub.Attach(client, ticket) {
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.sessions.Store(transport.ID, client)
+	go func() {
+		client.Run()
+		h.sessions.Delete(transport.ID)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PollSessionResponse{SessionID: transport.ID})
+}
+
+// Poll returns the session's events after the "cursor" query parameter,
+// waiting up to ws.PollWait for some to arrive.
+func (h *PollHandler) Poll(w http.ResponseWriter, r *http.Request) {
+	client := h.session(w, r)
+	if client == nil {
+		return
+	}
+
+	var cursor int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		var err error
+		if cursor, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A poll outlasts the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(ws.PollWait + 10*time.Second))
+
+	resp, err := client.Poll(r.Context(), cursor)
+	if errors.Is(err, ws.ErrPollInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SendEvent handles a request body holding one event, exactly as a
+// WebSocket frame would be. Replies such as ack and error arrive through
+// Poll.
+func (h *PollHandler) SendEvent(w http.ResponseWriter, r *http.Request) {
+	client := h.session(w, r)
+	if client == nil {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.Hub.Options().MaxMessageSize))
+	if err != nil {
+		http.Error(w, "Message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	h.Hub.HandleMessage(client, body)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PollHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	client := h.session(w, r)
+	if client == nil {
+		return
+	}
+
+	h.sessions.Delete(r.URL.Query().Get("session"))
+	h.Hub.Detach(client)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// session looks up the session named in the request, writing an error and
+// returning nil if it does not exist or belongs to someone else.
+func (h *PollHandler) session(w http.ResponseWriter, r *http.Request) *ws.Client {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	v, ok := h.sessions.Load(r.URL.Query().Get("session"))
+	if !ok || v.(*ws.Client).User.ID != user.ID {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil
+	}
+	return v.(*ws.Client)
+}
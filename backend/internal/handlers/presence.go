@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+type PresenceHandler struct {
+	DB  *database.DB
+	Hub *ws.Hub
+}
+
+func NewPresenceHandler(db *database.DB, hub *ws.Hub) *PresenceHandler {
+	return &PresenceHandler{DB: db, Hub: hub}
+}
+
+func (h *PresenceHandler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	presence := h.Hub.Presence(userID)
+	if presence.Status == ws.PresenceOffline {
+		lastSeen, err := h.DB.GetLastSeen(r.Context(), userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get presence", http.StatusInternalServerError)
+			return
+		}
+		presence.LastSeenAt = lastSeen
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presence)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/auth"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+// Actions a moderator can take when resolving a report as actioned.
+const (
+	reportActionDeleteMessage = "delete_message"
+	reportActionMuteAuthor    = "mute_author"
+	reportActionBanAuthor     = "ban_author"
+)
+
+const (
+	defaultReportMuteMinutes = 60
+	maxReportMuteMinutes     = 30 * 24 * 60
+)
+
+// reportTransitions lists the statuses each status may move to. Actioned
+// reports are final since their actions cannot be undone.
+var reportTransitions = map[string][]string{
+	database.ReportStatusOpen:      {database.ReportStatusDismissed, database.ReportStatusActioned},
+	database.ReportStatusDismissed: {database.ReportStatusOpen},
+}
+
+// ReportHandler takes message reports and serves the moderator queue, per
+// room under /api/rooms/{id} and for every room under /api/admin.
+type ReportHandler struct {
+	DB    *database.DB
+	Hub   *ws.Hub
+	Auth  *auth.Authenticator
+	Audit *audit.Logger
+}
+
+type ReportMessageRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ResolveReportRequest struct {
+	Status string `json:"status"`
+	// Actions are taken when Status is actioned.
+	Actions     []string `json:"actions"`
+	MuteMinutes int      `json:"mute_minutes"`
+}
+
+func NewReportHandler(db *database.DB, hub *ws.Hub, authn *auth.Authenticator, auditLog *audit.Logger) *ReportHandler {
+	return &ReportHandler{DB: db, Hub: hub, Auth: authn, Audit: auditLog}
+}
+
+// ReportMessage reports a message, as report_message does over a
+// WebSocket.
+func (h *ReportHandler) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ReportMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Hub.ReportMessage(r.Context(), user, chi.URLParam(r, "id"), req.Reason)
+	var rejected *ws.SendError
+	if errors.As(err, &rejected) {
+		status := http.StatusBadRequest
+		switch rejected.Code {
+		case ws.ErrCodeMessageNotFound:
+			status = http.StatusNotFound
+		case ws.ErrCodeAlreadyReported:
+			status = http.StatusConflict
+		}
+		http.Error(w, rejected.Message, status)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionReportCreate,
+		TargetType: audit.TargetReport,
+		TargetID:   report.ID,
+		Metadata:   map[string]interface{}{"message_id": report.MessageID, "room_id": report.RoomID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetReports lists reports oldest first, open ones unless the "status"
+// query parameter says otherwise ("all" for every status).
+func (h *ReportHandler) GetReports(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+	limit, offset := pagination(r, 50, 200)
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = database.ReportStatusOpen
+	case "all":
+		status = ""
+	case database.ReportStatusOpen, database.ReportStatusDismissed, database.ReportStatusActioned:
+	default:
+		http.Error(w, "Status must be open, dismissed, actioned or all", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := h.DB.GetReports(r.Context(), roomID, status, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get reports", http.StatusInternalServerError)
+		return
+	}
+
+	if reports == nil {
+		reports = []models.MessageReport{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ResolveReport moves a report to a new status. Resolving it as actioned
+// can also delete the message, mute its author in the room and, for
+// admins, ban the author.
+func (h *ReportHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := moderationScope(w, r, h.DB)
+	if !ok {
+		return
+	}
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report, err := h.DB.GetReport(r.Context(), chi.URLParam(r, "reportID"))
+	if err != nil || (roomID != "" && report.RoomID != roomID) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+
+	var req ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	allowed := false
+	for _, to := range reportTransitions[report.Status] {
+		allowed = allowed || to == req.Status
+	}
+	if !allowed {
+		http.Error(w, "A "+report.Status+" report cannot be moved to "+req.Status, http.StatusConflict)
+		return
+	}
+
+	if len(req.Actions) > 0 && req.Status != database.ReportStatusActioned {
+		http.Error(w, "Actions can only be taken when status is actioned", http.StatusBadRequest)
+		return
+	}
+	if req.MuteMinutes == 0 {
+		req.MuteMinutes = defaultReportMuteMinutes
+	}
+	for _, action := range req.Actions {
+		switch action {
+		case reportActionDeleteMessage:
+		case reportActionMuteAuthor:
+			if req.MuteMinutes < 1 || req.MuteMinutes > maxReportMuteMinutes {
+				http.Error(w, "mute_minutes must be between 1 and 43200", http.StatusBadRequest)
+				return
+			}
+		case reportActionBanAuthor:
+			if !user.IsAdmin {
+				http.Error(w, "Only admins can ban users", http.StatusForbidden)
+				return
+			}
+			if report.AuthorID == user.ID {
+				http.Error(w, "You cannot ban yourself", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Actions must be delete_message, mute_author or ban_author", http.StatusBadRequest)
+			return
+		}
+		if action != reportActionDeleteMessage && report.AuthorID == "" {
+			http.Error(w, "The author's account no longer exists", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Act before changing the status so a failed action leaves the report
+	// open to retry. The actions are idempotent, so a moderator racing
+	// another one to the same report repeats them harmlessly and then
+	// loses the status change below.
+	for _, action := range req.Actions {
+		if err := h.takeAction(r, report, action, time.Duration(req.MuteMinutes)*time.Minute); err != nil {
+			log.Printf("error taking %s on report %s: %v", action, report.ID, err)
+			http.Error(w, "Failed to "+strings.ReplaceAll(action, "_", " "), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resolved, err := h.DB.SetReportStatus(r.Context(), report.ID, report.Status, req.Status, strings.Join(req.Actions, ","), user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Report was changed by someone else", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update report", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionReportResolve,
+		TargetType: audit.TargetReport,
+		TargetID:   report.ID,
+		Metadata: map[string]interface{}{
+			"from":    report.Status,
+			"to":      resolved.Status,
+			"actions": req.Actions,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resolved)
+}
+
+func (h *ReportHandler) takeAction(r *http.Request, report *models.MessageReport, action string, muteFor time.Duration) error {
+	reason := "report " + report.ID
+
+	switch action {
+	case reportActionDeleteMessage:
+		if report.MessageID == "" {
+			return nil
+		}
+		msg, err := h.DB.GetMessageByID(r.Context(), report.MessageID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		deleted, err := h.Hub.DeleteMessage(r.Context(), msg)
+		if err != nil || !deleted {
+			return err
+		}
+		h.Audit.Record(r, audit.Event{
+			Action:     audit.ActionMessageDelete,
+			TargetType: audit.TargetMessage,
+			TargetID:   msg.ID,
+			Metadata:   map[string]interface{}{"room_id": msg.RoomID, "author_id": msg.UserID, "reason": reason},
+		})
+
+	case reportActionMuteAuthor:
+		user, _ := r.Context().Value(middleware.UserContextKey).(*models.User)
+		if err := h.Hub.MuteUser(r.Context(), report.RoomID, report.AuthorID, muteFor, reason, user.ID); err != nil {
+			return err
+		}
+		h.Audit.Record(r, audit.Event{
+			Action:     audit.ActionUserMute,
+			TargetType: audit.TargetUser,
+			TargetID:   report.AuthorID,
+			Metadata:   map[string]interface{}{"room_id": report.RoomID, "duration": muteFor.String(), "reason": reason},
+		})
+
+	case reportActionBanAuthor:
+		_, err := setUserStatus(r, h.DB, h.Auth, h.Hub, h.Audit, report.AuthorID, database.UserStatusBanned, reason)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxSlowModeSeconds  = 6 * 60 * 60
+	maxRoomMessageLimit = 10000
+)
+
+type RoomSettingsHandler struct {
+	DB    *database.DB
+	Hub   *ws.Hub
+	Audit *audit.Logger
+}
+
+type UpdateRoomSettingsRequest struct {
+	SlowModeSeconds  *int    `json:"slow_mode_seconds"`
+	ReadOnly         *bool   `json:"read_only"`
+	MaxMessageLength *int    `json:"max_message_length"`
+	LinkPolicy       *string `json:"link_policy"`
+}
+
+func NewRoomSettingsHandler(db *database.DB, hub *ws.Hub, auditLog *audit.Logger) *RoomSettingsHandler {
+	return &RoomSettingsHandler{DB: db, Hub: hub, Audit: auditLog}
+}
+
+func (h *RoomSettingsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.DB.GetRoomSettings(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get room settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings changes the fields present in the request, for the room's
+// owner or an admin, and pushes the result to the room's subscribers.
+func (h *RoomSettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	settings, _, ok := requireRoomModerator(w, r, h.DB)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoomSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SlowModeSeconds != nil {
+		if *req.SlowModeSeconds < 0 || *req.SlowModeSeconds > maxSlowModeSeconds {
+			http.Error(w, "slow_mode_seconds must be between 0 and 21600", http.StatusBadRequest)
+			return
+		}
+		settings.SlowModeSeconds = *req.SlowModeSeconds
+	}
+	if req.ReadOnly != nil {
+		settings.ReadOnly = *req.ReadOnly
+	}
+	if req.MaxMessageLength != nil {
+		if *req.MaxMessageLength < 0 || *req.MaxMessageLength > maxRoomMessageLimit {
+			http.Error(w, "max_message_length must be between 0 and 10000", http.StatusBadRequest)
+			return
+		}
+		settings.MaxMessageLength = *req.MaxMessageLength
+	}
+	if req.LinkPolicy != nil {
+		switch *req.LinkPolicy {
+		case models.LinkPolicyAllow, models.LinkPolicyModerators, models.LinkPolicyDeny:
+		default:
+			http.Error(w, "link_policy must be allow, moderators or deny", http.StatusBadRequest)
+			return
+		}
+		settings.LinkPolicy = *req.LinkPolicy
+	}
+
+	if err := h.DB.UpdateRoomSettings(r.Context(), settings); err != nil {
+		http.Error(w, "Failed to update room settings", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.SetRoomSettings(settings)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionRoomSettingsUpdate,
+		TargetType: audit.TargetRoom,
+		TargetID:   settings.RoomID,
+		Metadata: map[string]interface{}{
+			"slow_mode_seconds":  settings.SlowModeSeconds,
+			"read_only":          settings.ReadOnly,
+			"max_message_length": settings.MaxMessageLength,
+			"link_policy":        settings.LinkPolicy,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// requireRoomModerator checks that the user may moderate the room in the
+// URL, writing the error response and returning false if not.
+func requireRoomModerator(w http.ResponseWriter, r *http.Request, db *database.DB) (*models.RoomSettings, *models.User, bool) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	settings, err := db.GetRoomSettings(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to get room", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if !settings.CanModerate(user) {
+		http.Error(w, "Only the room owner or an admin can do that", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return settings, user, true
+}
+
+// moderationScope returns the room in the URL, once the user is known to
+// moderate it, or "" for the server-wide routes under /api/admin.
+func moderationScope(w http.ResponseWriter, r *http.Request, db *database.DB) (string, bool) {
+	roomID := chi.URLParam(r, "id")
+	if roomID == "" {
+		return "", true
+	}
+	if _, _, ok := requireRoomModerator(w, r, db); !ok {
+		return "", false
+	}
+	return roomID, true
+}
@@ -5,21 +5,25 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/ilhammramadhan/gabble/internal/audit"
 	"github.com/ilhammramadhan/gabble/internal/database"
 	"github.com/ilhammramadhan/gabble/internal/middleware"
 	"github.com/ilhammramadhan/gabble/internal/models"
+	ws "github.com/ilhammramadhan/gabble/internal/websocket"
 )
 
 type RoomHandler struct {
-	DB *database.DB
+	DB    *database.DB
+	Hub   *ws.Hub
+	Audit *audit.Logger
 }
 
 type CreateRoomRequest struct {
 	Name string `json:"name"`
 }
 
-func NewRoomHandler(db *database.DB) *RoomHandler {
-	return &RoomHandler{DB: db}
+func NewRoomHandler(db *database.DB, hub *ws.Hub, auditLog *audit.Logger) *RoomHandler {
+	return &RoomHandler{DB: db, Hub: hub, Audit: auditLog}
 }
 
 func (h *RoomHandler) GetRooms(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +65,13 @@ func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionRoomCreate,
+		TargetType: audit.TargetRoom,
+		TargetID:   room.ID,
+		Metadata:   map[string]interface{}{"name": room.Name},
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(room)
@@ -96,22 +107,41 @@ func (h *RoomHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.DB.DeleteRoom(r.Context(), roomID, user.ID); err != nil {
+	deleted, err := h.DB.DeleteRoom(r.Context(), roomID, user.ID)
+	if err != nil {
 		http.Error(w, "Failed to delete room", http.StatusInternalServerError)
 		return
 	}
+	if !deleted {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	h.Hub.CloseRoom(roomID)
+
+	h.Audit.Record(r, audit.Event{
+		Action:     audit.ActionRoomDelete,
+		TargetType: audit.TargetRoom,
+		TargetID:   roomID,
+	})
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *RoomHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middleware.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	roomID := chi.URLParam(r, "id")
 	if roomID == "" {
 		http.Error(w, "Room ID is required", http.StatusBadRequest)
 		return
 	}
 
-	messages, err := h.DB.GetMessagesByRoom(r.Context(), roomID, 100, 0)
+	messages, err := h.DB.GetMessagesByRoom(r.Context(), roomID, user.ID, 100, 0)
 	if err != nil {
 		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
 		return
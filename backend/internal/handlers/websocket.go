@@ -1,87 +1,91 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/auth"
 	"github.com/ilhammramadhan/gabble/internal/config"
 	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/middleware"
 	ws "github.com/ilhammramadhan/gabble/internal/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type WebSocketHandler struct {
 	Hub    *ws.Hub
 	DB     *database.DB
 	Config *config.Config
-}
+	Auth   *auth.Authenticator
 
-func NewWebSocketHandler(hub *ws.Hub, db *database.DB, cfg *config.Config) *WebSocketHandler {
-	return &WebSocketHandler{Hub: hub, DB: db, Config: cfg}
+	upgrader websocket.Upgrader
 }
 
-func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		authHeader := r.Header.Get("Authorization")
-		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-	}
-
-	if tokenString == "" {
-		http.Error(w, "Token required", http.StatusUnauthorized)
-		return
-	}
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(h.Config.JWTSecret), nil
-	})
-
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
+func NewWebSocketHandler(hub *ws.Hub, db *database.DB, cfg *config.Config, authn *auth.Authenticator, origins *config.OriginPolicy) *WebSocketHandler {
+	allowOrigin := middleware.OriginChecker(origins, "websocket")
+
+	return &WebSocketHandler{
+		Hub:    hub,
+		DB:     db,
+		Config: cfg,
+		Auth:   authn,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    cfg.WSReadBufferSize,
+			WriteBufferSize:   cfg.WSWriteBufferSize,
+			EnableCompression: cfg.WSCompression,
+			Subprotocols:      ws.Subprotocols,
+			// Browsers always send Origin; other clients are not subject to
+			// it.
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || allowOrigin(r, origin)
+			},
+		},
 	}
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.Hub.ShuttingDown() {
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
 		return
 	}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
-		http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+	principal, err := h.Auth.Authenticate(r, true)
+	if err != nil {
+		auth.WriteError(w, err)
 		return
 	}
 
-	user, err := h.DB.GetUserByID(r.Context(), userID)
+	ticket, err := h.Hub.Admit(principal.User.ID, middleware.ClientIP(r))
 	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		writeAdmissionError(w, err)
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		ticket.Release()
 		return
 	}
 
-	client := &ws.Client{
-		Hub:  h.Hub,
-		Conn: conn,
-		Send: make(chan []byte, 256),
-		User: user,
+	client := ws.NewClient(h.Hub, ws.NewWebSocketTransport(conn), principal.User)
+
+	if !h.Hub.Attach(client, ticket) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server restarting"))
+		conn.Close()
+		return
 	}
 
-	h.Hub.Register <- client
+	go client.Run()
+}
 
-	go client.WritePump()
-	go client.ReadPump()
+// writeAdmissionError reports a connection refused by Hub.Admit: 503 when
+// the server is full, 429 when the user or address is over its limit.
+func writeAdmissionError(w http.ResponseWriter, err error) {
+	status := http.StatusTooManyRequests
+	if errors.Is(err, ws.ErrServerFull) {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, err.Error(), status)
 }
@@ -0,0 +1,128 @@
+// Package metrics is a minimal registry of process-wide counters and gauges
+// exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// CounterVec is a family of counters partitioned by one label.
+type CounterVec struct {
+	label  string
+	mu     sync.RWMutex
+	values map[string]*Counter
+}
+
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, ok := v.values[value]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.values[value]; !ok {
+		c = &Counter{}
+		v.values[value] = c
+	}
+	return c
+}
+
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	write func(w io.Writer, name string)
+}
+
+var registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, existing := range registry.metrics {
+		if existing.name == m.name {
+			panic("metrics: duplicate metric " + m.name)
+		}
+	}
+	registry.metrics = append(registry.metrics, m)
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(metric{name: name, help: help, kind: "counter", write: func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	}})
+	return c
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, values: make(map[string]*Counter)}
+	register(metric{name: name, help: help, kind: "counter", write: func(w io.Writer, name string) {
+		v.mu.RLock()
+		keys := make([]string, 0, len(v.values))
+		for key := range v.values {
+			keys = append(keys, key)
+		}
+		v.mu.RUnlock()
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s{%s=%q} %d\n", name, v.label, key, v.With(key).Value())
+		}
+	}})
+	return v
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(metric{name: name, help: help, kind: "gauge", write: func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %g\n", name, fn())
+	}})
+}
+
+func WriteText(w io.Writer) {
+	registry.mu.Lock()
+	metrics := append([]metric(nil), registry.metrics...)
+	registry.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, strings.ReplaceAll(m.help, "\n", " "))
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		m.write(w, m.name)
+	}
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteText(w)
+}
@@ -3,59 +3,28 @@ package middleware
 import (
 	"context"
 	"net/http"
-	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/auth"
 )
 
 type contextKey string
 
-const UserContextKey contextKey = "user"
+const (
+	UserContextKey      contextKey = "user"
+	PrincipalContextKey contextKey = "principal"
+)
 
-func AuthMiddleware(db *database.DB, jwtSecret string) func(http.Handler) http.Handler {
+func AuthMiddleware(authn *auth.Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString == authHeader {
-				http.Error(w, "Invalid token format", http.StatusUnauthorized)
-				return
-			}
-
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				return []byte(jwtSecret), nil
-			})
-
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-				return
-			}
-
-			userID, ok := claims["user_id"].(string)
-			if !ok {
-				http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
-				return
-			}
-
-			user, err := db.GetUserByID(r.Context(), userID)
+			principal, err := authn.Authenticate(r, false)
 			if err != nil {
-				http.Error(w, "User not found", http.StatusUnauthorized)
+				auth.WriteError(w, err)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			ctx := context.WithValue(r.Context(), UserContextKey, principal.User)
+			ctx = context.WithValue(ctx, PrincipalContextKey, principal)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ilhammramadhan/gabble/internal/auth"
+	"github.com/ilhammramadhan/gabble/internal/config"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	cfg := &config.Config{FrontendURL: "https://chat.example.com"}
+	policy, err := cfg.OriginPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := CSRFProtect(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		cookie bool
+		bearer bool
+		origin string
+		want   int
+	}{
+		{"cookie from allowed origin", "POST", "/api/rooms", true, false, "https://chat.example.com", http.StatusOK},
+		{"cookie from other origin", "POST", "/api/rooms", true, false, "https://evil.example", http.StatusForbidden},
+		{"cookie without origin", "DELETE", "/api/rooms", true, false, "", http.StatusForbidden},
+		{"cookie on safe method", "GET", "/api/rooms", true, false, "https://evil.example", http.StatusOK},
+		{"bearer from other origin", "PUT", "/api/rooms", true, true, "https://evil.example", http.StatusOK},
+		{"no credentials", "POST", "/api/rooms", false, false, "https://evil.example", http.StatusOK},
+		{"logout from other origin", "POST", "/auth/logout", true, false, "https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: "token"})
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/ilhammramadhan/gabble/internal/ratelimit"
+)
+
+// RateLimit rejects requests over limiter's limit for the key returned by
+// key with 429 Too Many Requests and a Retry-After header.
+func RateLimit(limiter *ratelimit.Limiter, key func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := limiter.Allow(key(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the request's remote IP, as set by RealIP.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// UserKey keys requests by the authenticated user, falling back to the
+// client IP. It must run after AuthMiddleware to see the user.
+func UserKey(r *http.Request) string {
+	if user, ok := r.Context().Value(UserContextKey).(*models.User); ok {
+		return "user:" + user.ID
+	}
+	return "ip:" + ClientIP(r)
+}
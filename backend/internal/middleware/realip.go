@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP replaces r.RemoteAddr with the client's address for requests that
+// arrive through one of the trusted proxies. The address is the rightmost
+// X-Forwarded-For entry that is not itself a trusted proxy, or X-Real-IP
+// when there is no X-Forwarded-For. Requests from any other peer keep their
+// connection address, since anyone can send these headers.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := forwardedFor(r, trusted); ok {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forwardedFor(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	if len(trusted) == 0 || !isTrusted(ClientIP(r), trusted) {
+		return "", false
+	}
+
+	// Each proxy appends the address it received the request from, so
+	// entries left of the first untrusted one from the right are
+	// client-supplied.
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return "", false
+			}
+			if !isTrusted(addr.String(), trusted) {
+				return addr.Unmap().String(), true
+			}
+		}
+		return "", false
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String(), true
+	}
+	return "", false
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// AutomodRule is an auto-moderation rule for one room, or for every room
+// when RoomID is empty. Pattern holds the word, regular expression or
+// domain for the kinds that match text; Threshold tunes the heuristics.
+type AutomodRule struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room_id,omitempty"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Threshold int       `json:"threshold,omitempty"`
+	Action    string    `json:"action"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AutomodHit records a rule matching a message. MessageID is empty when the
+// message was refused.
+type AutomodHit struct {
+	ID        int64     `json:"id"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	MessageID string    `json:"message_id,omitempty"`
+	Kind      string    `json:"kind"`
+	Action    string    `json:"action"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomMute stops a user posting in a room until MutedUntil.
+type RoomMute struct {
+	RoomID     string    `json:"room_id"`
+	UserID     string    `json:"user_id"`
+	MutedUntil time.Time `json:"muted_until"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+}
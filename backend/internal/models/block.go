@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// Block is a user someone has blocked.
+type Block struct {
+	User      *User     `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
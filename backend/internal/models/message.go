@@ -5,10 +5,12 @@ import (
 )
 
 type Message struct {
-	ID        string    `json:"id"`
-	RoomID    string    `json:"room_id"`
-	UserID    string    `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	User      *User     `json:"user,omitempty"`
+	ID          string    `json:"id"`
+	RoomID      string    `json:"room_id"`
+	UserID      string    `json:"user_id"`
+	Seq         int64     `json:"seq"`
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+	User        *User     `json:"user,omitempty"`
 }
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Pin is a message pinned in its room.
+type Pin struct {
+	Message  *Message  `json:"message"`
+	PinnedBy string    `json:"pinned_by,omitempty"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MessageReport is a user's report of a message, or a message flagged by
+// auto-moderation when ReporterID is empty. AuthorID and Content are kept
+// from the message so the report outlives its deletion.
+type MessageReport struct {
+	ID           string     `json:"id"`
+	MessageID    string     `json:"message_id,omitempty"`
+	RoomID       string     `json:"room_id"`
+	AuthorID     string     `json:"author_id,omitempty"`
+	AuthorName   string     `json:"author_name,omitempty"`
+	ReporterID   string     `json:"reporter_id,omitempty"`
+	ReporterName string     `json:"reporter_name,omitempty"`
+	Content      string     `json:"content"`
+	Reason       string     `json:"reason"`
+	Status       string     `json:"status"`
+	Resolution   string     `json:"resolution,omitempty"`
+	ResolvedBy   string     `json:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// Link policies for RoomSettings.LinkPolicy.
+const (
+	LinkPolicyAllow      = "allow"
+	LinkPolicyModerators = "moderators"
+	LinkPolicyDeny       = "deny"
+)
+
+// RoomSettings are a room's posting policies.
+type RoomSettings struct {
+	RoomID  string `json:"room_id"`
+	OwnerID string `json:"owner_id"`
+	// SlowModeSeconds is the minimum time between one user's messages; 0
+	// turns slow mode off.
+	SlowModeSeconds int `json:"slow_mode_seconds"`
+	// ReadOnly lets only moderators post, for announcement rooms.
+	ReadOnly bool `json:"read_only"`
+	// MaxMessageLength caps messages, in characters; 0 means no limit.
+	MaxMessageLength int    `json:"max_message_length"`
+	LinkPolicy       string `json:"link_policy"`
+}
+
+// CanModerate reports whether user moderates the room: its owner and
+// server admins do. Moderators are exempt from the room's posting
+// policies.
+func (s *RoomSettings) CanModerate(user *User) bool {
+	return user.IsAdmin || (s.OwnerID != "" && s.OwnerID == user.ID)
+}
@@ -9,5 +9,18 @@ type User struct {
 	GithubID  string    `json:"github_id"`
 	Username  string    `json:"username"`
 	AvatarURL string    `json:"avatar_url"`
+	IsAdmin   bool      `json:"is_admin"`
+	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	// TokenVersion is signed into session tokens and bumped when the
+	// password changes, revoking older tokens.
+	TokenVersion int `json:"-"`
+}
+
+// Provider returns the login method the account belongs to.
+func (u *User) Provider() string {
+	if u.GithubID != "" {
+		return "github"
+	}
+	return "local"
 }
@@ -0,0 +1,135 @@
+// Package ratelimit implements token bucket rate limiters keyed by strings
+// such as user IDs and IP addresses.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/metrics"
+)
+
+var rejected = metrics.NewCounterVec(
+	"gabble_rate_limited_total",
+	"Requests and events refused by a rate limiter.",
+	"limit",
+)
+
+// Limit allows Count events per Per, in bursts of up to Count. The zero
+// Limit allows everything.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Count > 0 && l.Per > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Count, l.Per)
+}
+
+// Parse reads a limit written as "<count>/<duration>", such as "10/10s" or
+// "100/m". "off", "0" and "" disable the limit.
+func Parse(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	count, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want <count>/<duration>", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad count", s)
+	}
+	// Allow "s", "m" and "h" on their own.
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad duration", s)
+	}
+	return Limit{Count: n, Per: d}, nil
+}
+
+// Limiter is a set of token buckets with the same Limit, one per key. A nil
+// Limiter allows everything.
+type Limiter struct {
+	name  string
+	limit Limit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter; name labels its rejections in metrics.
+func New(name string, limit Limit) *Limiter {
+	return &Limiter{
+		name:    name,
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. If there is none it returns false
+// and how long until there will be.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || !l.limit.Enabled() {
+		return true, 0
+	}
+
+	now := time.Now()
+	burst := float64(l.limit.Count)
+	rate := burst / l.limit.Per.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	rejected.With(l.name).Inc()
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// sweep drops buckets that have had time to refill completely, since they
+// are no different from new ones. It runs at most once per Limit.Per.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	l.nextSweep = now.Add(l.limit.Per)
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.limit.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"", Limit{}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"10/10s", Limit{Count: 10, Per: 10 * time.Second}, false},
+		{" 100/m ", Limit{Count: 100, Per: time.Minute}, false},
+		{"5/h", Limit{Count: 5, Per: time.Hour}, false},
+		{"10", Limit{}, true},
+		{"x/10s", Limit{}, true},
+		{"-1/10s", Limit{}, true},
+		{"10/0s", Limit{}, true},
+		{"10/fortnight", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l := New("test", Limit{Count: 3, Per: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok {
+		t.Fatal("request past the burst allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 20*time.Second {
+		t.Errorf("retryAfter = %s, want up to one token's refill of 20s", retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key shares the exhausted bucket")
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	l := New("test", Limit{Count: 1, Per: 20 * time.Millisecond})
+
+	l.Allow("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("second request allowed")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request refused after the bucket refilled")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	var nilLimiter *Limiter
+	for _, l := range []*Limiter{nilLimiter, New("off", Limit{})} {
+		for i := 0; i < 100; i++ {
+			if ok, _ := l.Allow("a"); !ok {
+				t.Fatal("disabled limiter refused a request")
+			}
+		}
+	}
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	const count = 50
+	l := New("test", Limit{Count: count, Per: time.Hour})
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				if ok, _ := l.Allow("a"); ok {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed.Load() != count {
+		t.Errorf("allowed %d requests, want %d", allowed.Load(), count)
+	}
+}
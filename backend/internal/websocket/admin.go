@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type ConnectionStats struct {
+	Total      int            `json:"total"`
+	Transports map[string]int `json:"transports"`
+	Rooms      map[string]int `json:"rooms"`
+}
+
+func (h *Hub) ConnectionStats() ConnectionStats {
+	var stats ConnectionStats
+	stats.Transports = make(map[string]int)
+	h.call(func() {
+		stats.Total = len(h.clients)
+		for client := range h.clients {
+			stats.Transports[client.transportName()]++
+		}
+	})
+
+	stats.Rooms = make(map[string]int)
+	h.rooms.Range(func(key, value interface{}) bool {
+		if size := value.(*Room).size.Load(); size > 0 {
+			stats.Rooms[key.(string)] = int(size)
+		}
+		return true
+	})
+	return stats
+}
+
+// DisconnectUser closes every live connection belonging to userID with a
+// policy violation close frame carrying reason, discarding anything still
+// queued. The read pumps then unregister the clients as usual. It returns
+// the number of connections closed.
+func (h *Hub) DisconnectUser(userID, reason string) int {
+	clients := h.userClients(userID)
+	for _, client := range clients {
+		client.Close(websocket.ClosePolicyViolation, reason, true)
+	}
+	return len(clients)
+}
+
+// RefreshUser closes userID's live connections with CloseServiceRestart
+// once their queued frames are written, so clients reconnect and are
+// authenticated afresh. Connections hold the user as it was when they
+// opened, so this is how changes such as the admin flag reach them. It
+// returns the number of connections closed.
+func (h *Hub) RefreshUser(userID string) int {
+	clients := h.userClients(userID)
+	for _, client := range clients {
+		client.Close(websocket.CloseServiceRestart, "account updated", false)
+	}
+	return len(clients)
+}
+
+func (h *Hub) userClients(userID string) []*Client {
+	var clients []*Client
+	h.call(func() {
+		for client := range h.clients {
+			if client.User.ID == userID {
+				clients = append(clients, client)
+			}
+		}
+	})
+	return clients
+}
+
+// Announce sends a system announcement to every connected client.
+func (h *Hub) Announce(message string) {
+	out := newOutbound(&WSMessage{
+		Type: EventSystemAnnouncement,
+		Payload: SystemAnnouncementPayload{
+			Message:   message,
+			CreatedAt: time.Now(),
+		},
+	})
+
+	h.call(func() {
+		for client := range h.clients {
+			client.sendOutbound(out, false)
+		}
+	})
+}
+
+// CloseRoom tells everyone in a deleted room that it is gone and drops the
+// room's membership.
+func (h *Hub) CloseRoom(roomID string) {
+	h.policies.Delete(roomID)
+	h.deliver(roomID, roomCommand{kind: cmdClose}, false)
+}
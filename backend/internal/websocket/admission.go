@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/metrics"
+)
+
+var (
+	ErrServerFull          = errors.New("Server is at its connection limit")
+	ErrUserConnectionLimit = errors.New("Too many connections for this user")
+	ErrIPConnectionLimit   = errors.New("Too many connections from this address")
+)
+
+var (
+	admissionRejections = metrics.NewCounterVec(
+		"gabble_ws_admission_rejected_total",
+		"Connections refused by admission control.",
+		"reason",
+	)
+	admissionEvictions = metrics.NewCounter(
+		"gabble_ws_admission_evictions_total",
+		"Connections closed to make room for a newer one from the same user.",
+	)
+)
+
+// admission counts connection slots by user and IP. Slots are taken by
+// Admit before a connection is set up, so limits hold however many connect
+// at once.
+type admission struct {
+	mu    sync.Mutex
+	total int
+	users map[string]int
+	ips   map[string]int
+}
+
+// Ticket is a connection slot reserved by Admit. Attach hands it to the
+// client, which gives it back when it unregisters.
+type Ticket struct {
+	hub    *Hub
+	userID string
+	ip     string
+
+	once sync.Once
+}
+
+// Admit reserves a connection slot for userID connecting from ip, or
+// returns ErrServerFull, ErrUserConnectionLimit or ErrIPConnectionLimit.
+// ip must be the address resolved by middleware.RealIP, never a forwarding
+// header read directly. With Options.EvictOldest, a user at their limit is
+// let in and their oldest connection closed instead.
+func (h *Hub) Admit(userID, ip string) (*Ticket, error) {
+	ip = addressKey(ip)
+	a := &h.admission
+	a.mu.Lock()
+
+	if max := h.opts.MaxConnections; max > 0 && a.total >= max {
+		a.mu.Unlock()
+		admissionRejections.With("total").Inc()
+		return nil, ErrServerFull
+	}
+	if max := h.opts.MaxConnectionsPerIP; max > 0 && a.ips[ip] >= max {
+		a.mu.Unlock()
+		admissionRejections.With("ip").Inc()
+		return nil, ErrIPConnectionLimit
+	}
+	evict := false
+	if max := h.opts.MaxConnectionsPerUser; max > 0 && a.users[userID] >= max {
+		if !h.opts.EvictOldest {
+			a.mu.Unlock()
+			admissionRejections.With("user").Inc()
+			return nil, ErrUserConnectionLimit
+		}
+		evict = true
+	}
+
+	a.total++
+	a.users[userID]++
+	a.ips[ip]++
+	a.mu.Unlock()
+
+	if evict {
+		h.evictOldest(userID)
+	}
+	return &Ticket{hub: h, userID: userID, ip: ip}, nil
+}
+
+// addressKey is the key ip counts against MaxConnectionsPerIP. IPv6
+// addresses are grouped by /64, the block a single host is usually given,
+// so rotating through it does not buy more connections.
+func addressKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	return netip.PrefixFrom(addr, 64).Masked().String()
+}
+
+// Release gives the slot back. It is safe to call more than once and on a
+// nil Ticket.
+func (t *Ticket) Release() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		a := &t.hub.admission
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		a.total--
+		if a.users[t.userID]--; a.users[t.userID] <= 0 {
+			delete(a.users, t.userID)
+		}
+		if a.ips[t.ip]--; a.ips[t.ip] <= 0 {
+			delete(a.ips, t.ip)
+		}
+	})
+}
+
+// evictOldest closes userID's longest-lived connection, releasing its slot
+// straight away rather than once it has finished closing.
+func (h *Hub) evictOldest(userID string) {
+	var oldest *Client
+	h.call(func() {
+		for client := range h.clients {
+			if client.User.ID != userID || client.isClosed() {
+				continue
+			}
+			if oldest == nil || client.connectedAt.Before(oldest.connectedAt) {
+				oldest = client
+			}
+		}
+	})
+	if oldest == nil {
+		return
+	}
+
+	admissionEvictions.Inc()
+	oldest.ticket.Release()
+	oldest.Close(websocket.ClosePolicyViolation, "replaced by a newer connection", false)
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAdmitConcurrent(t *testing.T) {
+	const max = 20
+	h := NewHub(nil, nil, Options{MaxConnections: max})
+
+	var admitted atomic.Int64
+	tickets := make(chan *Ticket, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ticket, err := h.Admit(fmt.Sprintf("u%d", i), fmt.Sprintf("203.0.113.%d", i))
+			if err == nil {
+				admitted.Add(1)
+				tickets <- ticket
+			} else if !errors.Is(err, ErrServerFull) {
+				t.Errorf("Admit: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(tickets)
+	if admitted.Load() != max {
+		t.Fatalf("admitted %d connections, want %d", admitted.Load(), max)
+	}
+
+	for ticket := range tickets {
+		wg.Add(1)
+		go func(ticket *Ticket) {
+			defer wg.Done()
+			ticket.Release()
+		}(ticket)
+	}
+	wg.Wait()
+	if _, err := h.Admit("late", "198.51.100.1"); err != nil {
+		t.Errorf("Admit after every ticket was released: %v", err)
+	}
+}
+
+func TestAddressKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{"::ffff:203.0.113.7", "203.0.113.7"},
+		{"2001:db8:1:2:aaaa::1", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:bbbb::9", "2001:db8:1:2::/64"},
+		{"not-an-ip", "not-an-ip"},
+	}
+	for _, tt := range tests {
+		if got := addressKey(tt.ip); got != tt.want {
+			t.Errorf("addressKey(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAdmitPerIPLimit(t *testing.T) {
+	h := NewHub(nil, nil, Options{MaxConnectionsPerIP: 2})
+
+	var tickets []*Ticket
+	for _, ip := range []string{"2001:db8::1", "2001:db8::2"} {
+		ticket, err := h.Admit("u-"+ip, ip)
+		if err != nil {
+			t.Fatalf("Admit(%s): %v", ip, err)
+		}
+		tickets = append(tickets, ticket)
+	}
+	if _, err := h.Admit("u3", "2001:db8::3"); !errors.Is(err, ErrIPConnectionLimit) {
+		t.Fatalf("third connection from the same /64: err = %v, want ErrIPConnectionLimit", err)
+	}
+	if _, err := h.Admit("u4", "2001:db8:0:1::1"); err != nil {
+		t.Fatalf("connection from another /64: %v", err)
+	}
+
+	tickets[0].Release()
+	tickets[0].Release()
+	if _, err := h.Admit("u5", "2001:db8::5"); err != nil {
+		t.Fatalf("Admit after release: %v", err)
+	}
+	if _, err := h.Admit("u6", "2001:db8::6"); !errors.Is(err, ErrIPConnectionLimit) {
+		t.Fatalf("double Release freed two slots: err = %v", err)
+	}
+}
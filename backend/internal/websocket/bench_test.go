@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func benchMessage(roomID string) *WSMessage {
+	return &WSMessage{
+		Type: EventMessage,
+		Payload: MessagePayload{
+			ID:        "msg-1",
+			RoomID:    roomID,
+			Content:   "benchmark",
+			User:      &models.User{ID: "sender", Username: "sender"},
+			CreatedAt: time.Now(),
+		},
+	}
+}
+
+// BenchmarkFanout measures one room queueing a message for every member,
+// with outboxes emptied between iterations.
+func BenchmarkFanout(b *testing.B) {
+	for _, members := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("members=%d", members), func(b *testing.B) {
+			h := NewHub(nil, nil, Options{})
+			r := newRoom(h, "r1")
+			clients := make([]*Client, members)
+			for i := range clients {
+				clients[i] = NewClient(h, nil, &models.User{ID: fmt.Sprintf("u%d", i)})
+				r.focus(clients[i])
+			}
+			msg := benchMessage("r1")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.fanout(newOutbound(msg), false, false, nil, "")
+				for _, c := range clients {
+					c.out.frames = c.out.frames[:0]
+				}
+			}
+			b.ReportMetric(float64(b.N*members)/b.Elapsed().Seconds(), "deliveries/s")
+		})
+	}
+}
+
+// BenchmarkHubBroadcast measures broadcasts end to end across many rooms,
+// with a goroutine per client draining its frames.
+func BenchmarkHubBroadcast(b *testing.B) {
+	for _, s := range []struct{ rooms, clients int }{{10, 100}, {1000, 10}, {10000, 2}} {
+		b.Run(fmt.Sprintf("rooms=%d/clients=%d", s.rooms, s.clients), func(b *testing.B) {
+			h := newTestHub(b, Options{SlowConsumerPolicy: PolicyDropOldest})
+			var delivered atomic.Int64
+			var drains sync.WaitGroup
+			for room := 0; room < s.rooms; room++ {
+				roomID := fmt.Sprintf("room-%d", room)
+				for i := 0; i < s.clients; i++ {
+					c := connect(h, fmt.Sprintf("u%d-%d", room, i))
+					join(h, c, roomID)
+					drains.Add(1)
+					go func() {
+						defer drains.Done()
+						for {
+							frames, ok := c.Next()
+							if !ok {
+								return
+							}
+							delivered.Add(int64(len(frames)))
+						}
+					}()
+				}
+			}
+			b.Cleanup(func() {
+				h.Shutdown(context.Background())
+				drains.Wait()
+			})
+			msgs := make([]*WSMessage, s.rooms)
+			for room := range msgs {
+				msgs[room] = benchMessage(fmt.Sprintf("room-%d", room))
+			}
+			// Let join and presence fan-out settle so it is not counted.
+			waitQuiet(&delivered)
+			delivered.Store(0)
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					room := int(next.Add(1)) % s.rooms
+					h.Broadcast(fmt.Sprintf("room-%d", room), msgs[room])
+				}
+			})
+			// Broadcasting only queues the message in the room's mailbox, so
+			// keep the clock running until the rooms have delivered it.
+			waitQuiet(&delivered)
+			b.ReportMetric(float64(delivered.Load())/b.Elapsed().Seconds(), "deliveries/s")
+		})
+	}
+}
+
+// waitQuiet returns once n has stopped changing for 20ms.
+func waitQuiet(n *atomic.Int64) {
+	last := n.Load()
+	for {
+		time.Sleep(20 * time.Millisecond)
+		cur := n.Load()
+		if cur == last {
+			return
+		}
+		last = cur
+	}
+}
+
+func BenchmarkOutboxPush(b *testing.B) {
+	o := newOutbox(DefaultOptions.SendBufferSize, PolicyDropOldest)
+	f := frame{data: []byte(`{"type":"message"}`)}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			o.push(f)
+		}
+	})
+}
+
+func BenchmarkCodecEncode(b *testing.B) {
+	for _, codec := range codecs {
+		b.Run(codec.Name(), func(b *testing.B) {
+			msg := benchMessage("r1")
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := newOutbound(msg).encode(codec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
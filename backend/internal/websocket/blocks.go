@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"context"
+	"log"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// loadBlocks fetches the users client's user has blocked, whose messages
+// and typing indicators it is not sent. If SetBlocked changes the set while
+// the query runs, the query is repeated so the change is not overwritten.
+func (h *Hub) loadBlocks(client *Client) {
+	if h.DB == nil {
+		return
+	}
+	for {
+		current := client.blocked.Load()
+		blocked, err := h.DB.GetBlockedIDs(context.Background(), client.User.ID)
+		if err != nil {
+			log.Printf("error loading blocks for %s: %v", client.User.ID, err)
+			return
+		}
+		if client.blocked.CompareAndSwap(current, &blocked) {
+			return
+		}
+	}
+}
+
+// SetBlocked applies userID blocking or unblocking blockedID to their live
+// connections.
+func (h *Hub) SetBlocked(userID, blockedID string, blocked bool) {
+	h.call(func() {
+		for client := range h.clients {
+			if client.User.ID == userID {
+				client.setBlocked(blockedID, blocked)
+			}
+		}
+	})
+}
+
+func (c *Client) setBlocked(userID string, blocked bool) {
+	for {
+		current := c.blocked.Load()
+		next := make(map[string]bool)
+		if current != nil {
+			for id := range *current {
+				next[id] = true
+			}
+		}
+		if blocked {
+			next[userID] = true
+		} else {
+			delete(next, userID)
+		}
+		if c.blocked.CompareAndSwap(current, &next) {
+			return
+		}
+	}
+}
+
+// blocks reports whether the client's user has blocked userID.
+func (c *Client) blocks(userID string) bool {
+	blocked := c.blocked.Load()
+	return userID != "" && blocked != nil && (*blocked)[userID]
+}
+
+// visible returns users without the ones the client's user has blocked,
+// or users itself if there are none.
+func (c *Client) visible(users []*models.User) []*models.User {
+	blocked := c.blocked.Load()
+	if blocked == nil || len(*blocked) == 0 {
+		return users
+	}
+	var kept []*models.User
+	for _, user := range users {
+		if !(*blocked)[user.ID] {
+			kept = append(kept, user)
+		}
+	}
+	if len(kept) == len(users) {
+		return users
+	}
+	if kept == nil {
+		kept = []*models.User{}
+	}
+	return kept
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func TestSetBlockedConcurrent(t *testing.T) {
+	c := NewClient(NewHub(nil, nil, Options{}), nil, &models.User{ID: "u1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.setBlocked(fmt.Sprintf("b%d", i), true)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		if id := fmt.Sprintf("b%d", i); !c.blocks(id) {
+			t.Errorf("block of %s was lost", id)
+		}
+	}
+}
+
+func TestSetBlockedReachesAttachedClient(t *testing.T) {
+	h := newTestHub(t, Options{})
+	c := NewClient(h, nil, &models.User{ID: "u1"})
+	if !h.Attach(c, nil) {
+		t.Fatal("Attach refused the client")
+	}
+
+	h.SetBlocked("u1", "u2", true)
+	if !c.blocks("u2") {
+		t.Error("block did not reach the attached client")
+	}
+	h.SetBlocked("u1", "u2", false)
+	if c.blocks("u2") {
+		t.Error("unblock did not reach the attached client")
+	}
+}
@@ -1,91 +1,233 @@
 package websocket
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/ilhammramadhan/gabble/internal/models"
 )
 
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 4096
-)
+// maxSubscriptions caps how many rooms one connection can follow.
+const maxSubscriptions = 100
+
+var errTooManySubscriptions = errors.New("Too many room subscriptions")
 
 type Client struct {
-	Hub     *Hub
-	Conn    *websocket.Conn
-	Send    chan []byte
-	User    *models.User
-	RoomID  string
-}
-
-func (c *Client) ReadPump() {
-	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
-	}()
-
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-		return nil
-	})
+	Hub  *Hub
+	User *models.User
+
+	transport Transport
+	// ticket is the connection slot from Admit, released on unregister.
+	ticket      *Ticket
+	connectedAt time.Time
+
+	out *outbox
+	// done is closed once the consumer of out has written or taken the
+	// close frame; see finish.
+	done       chan struct{}
+	finishOnce sync.Once
+
+	// mu guards rooms and focused.
+	mu sync.Mutex
+	// rooms is the set of rooms the client receives messages from.
+	rooms map[string]bool
+	// focused is the subscribed room the client has open. Presence and
+	// typing indicators only involve focused clients.
+	focused string
+
+	// lastActive is when the user last did something on this connection,
+	// in Unix nanoseconds; idle is set when the client says the user has
+	// stepped away.
+	lastActive atomic.Int64
+	idle       atomic.Bool
+
+	// protocol is the negotiated protocol version and codec the wire
+	// format; greeted is set once the client has sent hello.
+	protocol string
+	codec    Codec
+	greeted  atomic.Bool
+
+	// blocked is the set of user IDs the user has blocked; see blocks.go.
+	blocked atomic.Pointer[map[string]bool]
+}
+
+// NewClient creates a client for user connected over transport. A nil
+// transport makes a client whose frames are read with Next.
+func NewClient(hub *Hub, transport Transport, user *models.User) *Client {
+	c := &Client{
+		Hub:       hub,
+		User:      user,
+		transport: transport,
+		out:       newOutbox(hub.opts.SendBufferSize, hub.opts.SlowConsumerPolicy),
+		done:      make(chan struct{}),
+		rooms:     make(map[string]bool),
+
+		connectedAt: time.Now(),
+
+		protocol: ProtocolV1,
+		codec:    JSON,
+	}
+	if transport != nil {
+		c.protocol, c.codec = transport.Protocol()
+	}
+	c.lastActive.Store(time.Now().UnixNano())
+	return c
+}
 
+// touch records activity, reporting whether the connection was idle until
+// now and the user's presence may need to change.
+func (c *Client) touch() bool {
+	now := time.Now()
+	wasActive := c.active(now)
+	c.lastActive.Store(now.UnixNano())
+	c.idle.Store(false)
+	return !wasActive
+}
+
+// markIdle flags the connection idle, reporting whether it changed.
+func (c *Client) markIdle() bool {
+	return !c.idle.Swap(true)
+}
+
+func (c *Client) active(now time.Time) bool {
+	return !c.idle.Load() && now.Sub(c.lastActiveAt()) < awayAfter
+}
+
+func (c *Client) lastActiveAt() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// send encodes msg for the client and queues it without blocking; see
+// outbox.push.
+func (c *Client) send(msg *WSMessage, droppable bool) bool {
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		log.Printf("error encoding %s: %v", msg.Type, err)
+		return false
+	}
+	return c.out.push(frame{data: data, droppable: droppable, seq: messageSeq(msg)})
+}
+
+// sendOutbound is send for a message going to many clients.
+func (c *Client) sendOutbound(out *outbound, droppable bool) bool {
+	data, err := out.encode(c.codec)
+	if err != nil {
+		log.Printf("error encoding %s: %v", out.msg.Type, err)
+		return false
+	}
+	return c.out.push(frame{data: data, droppable: droppable, seq: out.seq})
+}
+
+// Close stops the client's outbound queue. The transport delivers what is
+// already queued unless discard is set, then sends a close frame with code
+// and reason.
+func (c *Client) Close(code int, reason string, discard bool) {
+	c.out.close(code, reason, discard)
+}
+
+func (c *Client) finish() {
+	c.finishOnce.Do(func() { close(c.done) })
+}
+
+func (c *Client) isClosed() bool {
+	return c.out.isClosed()
+}
+
+// Run serves the client over its transport until the connection ends, then
+// detaches it from the hub.
+func (c *Client) Run() {
+	defer c.Hub.Detach(c)
+	c.transport.Run(c)
+}
+
+// transportName names the client's transport for ConnectionStats.
+func (c *Client) transportName() string {
+	if c.transport == nil {
+		return "none"
+	}
+	return c.transport.Name()
+}
+
+// Next blocks until frames are queued for the client and returns them in
+// order. It returns false once the client is closed and every frame queued
+// before that has been returned. It is for clients without a transport.
+func (c *Client) Next() ([][]byte, bool) {
 	for {
-		_, message, err := c.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+		frames, closed := c.out.take()
+		if len(frames) > 0 {
+			data := make([][]byte, len(frames))
+			for i, f := range frames {
+				data[i] = f.data
 			}
-			break
+			return data, true
 		}
-
-		var wsMsg WSMessage
-		if err := json.Unmarshal(message, &wsMsg); err != nil {
-			log.Printf("error unmarshaling message: %v", err)
-			continue
+		if closed {
+			c.finish()
+			return nil, false
 		}
+		<-c.out.ready
+	}
+}
+
+// subscribe adds roomID to the client's subscriptions, reporting whether
+// it was new.
+func (c *Client) subscribe(roomID string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribeLocked(roomID)
+}
 
-		c.Hub.HandleMessage(c, &wsMsg)
+func (c *Client) subscribeLocked(roomID string) (bool, error) {
+	if c.rooms[roomID] {
+		return false, nil
 	}
+	if len(c.rooms) >= maxSubscriptions {
+		return false, errTooManySubscriptions
+	}
+	c.rooms[roomID] = true
+	return true, nil
 }
 
-func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
-	defer func() {
-		ticker.Stop()
-		c.Conn.Close()
-	}()
+// focus subscribes to roomID if needed and makes it the focused room,
+// returning the previously focused one.
+func (c *Client) focus(roomID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	for {
-		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+	if _, err := c.subscribeLocked(roomID); err != nil {
+		return "", err
+	}
+	previous := c.focused
+	c.focused = roomID
+	return previous, nil
+}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
+// unsubscribe removes roomID from the client's subscriptions, reporting
+// whether it was subscribed.
+func (c *Client) unsubscribe(roomID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-			if err := w.Close(); err != nil {
-				return
-			}
-		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
+	if !c.rooms[roomID] {
+		return false
+	}
+	delete(c.rooms, roomID)
+	if c.focused == roomID {
+		c.focused = ""
+	}
+	return true
+}
+
+func (c *Client) subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rooms := make([]string, 0, len(c.rooms))
+	for roomID := range c.rooms {
+		rooms = append(rooms, roomID)
 	}
+	return rooms
 }
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes frames for one wire format. A connection's
+// codec is chosen by its subprotocol (see parseSubprotocol) and never
+// changes.
+type Codec interface {
+	// Name is the subprotocol suffix selecting the codec, as in
+	// "gabble.v2+msgpack".
+	Name() string
+	// FrameType is the WebSocket message type frames are sent as.
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// decodeEnvelope splits a frame into its event type and the payload,
+	// still encoded, so handlers can decode it straight into their own
+	// payload type.
+	decodeEnvelope(data []byte) (EventType, []byte, error)
+}
+
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+
+	codecs = []Codec{JSON, MessagePack}
+)
+
+func codecByName(name string) Codec {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string   { return "json" }
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) decodeEnvelope(data []byte) (EventType, []byte, error) {
+	var envelope struct {
+		Type    EventType       `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", nil, err
+	}
+	return envelope.Type, envelope.Payload, nil
+}
+
+// msgpackCodec uses the same field names as JSON by reading the json
+// struct tags.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string   { return "msgpack" }
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (c msgpackCodec) decodeEnvelope(data []byte) (EventType, []byte, error) {
+	var envelope struct {
+		Type    EventType          `json:"type"`
+		Payload msgpack.RawMessage `json:"payload"`
+	}
+	if err := c.Unmarshal(data, &envelope); err != nil {
+		return "", nil, err
+	}
+	return envelope.Type, envelope.Payload, nil
+}
+
+// inbound is a frame received from a client, with its payload left
+// encoded until a handler decodes it.
+type inbound struct {
+	Type    EventType
+	payload []byte
+	codec   Codec
+}
+
+// decode unmarshals the payload into v. A missing payload leaves v as is.
+func (m *inbound) decode(v interface{}) error {
+	if len(m.payload) == 0 {
+		return nil
+	}
+	return m.codec.Unmarshal(m.payload, v)
+}
+
+// outbound is a message being sent to many clients. It is encoded at most
+// once per codec, on first use, and must only be used from one goroutine.
+type outbound struct {
+	msg     *WSMessage
+	seq     int64
+	encoded [][]byte
+}
+
+func newOutbound(msg *WSMessage) *outbound {
+	return &outbound{msg: msg, seq: messageSeq(msg), encoded: make([][]byte, len(codecs))}
+}
+
+func (o *outbound) encode(codec Codec) ([]byte, error) {
+	for i, c := range codecs {
+		if c != codec {
+			continue
+		}
+		if o.encoded[i] == nil {
+			data, err := codec.Marshal(o.msg)
+			if err != nil {
+				return nil, err
+			}
+			o.encoded[i] = data
+		}
+		return o.encoded[i], nil
+	}
+	return codec.Marshal(o.msg)
+}
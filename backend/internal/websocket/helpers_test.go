@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// newTestHub starts a hub without a database and stops it, without waiting
+// for clients to drain, when the test ends.
+func newTestHub(t testing.TB, opts Options) *Hub {
+	t.Helper()
+	h := NewHub(nil, nil, opts)
+	go h.Run()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		h.Shutdown(ctx)
+	})
+	return h
+}
+
+// connect registers a connectionless client for userID.
+func connect(h *Hub, userID string) *Client {
+	c := NewClient(h, nil, &models.User{ID: userID, Username: userID})
+	h.Register <- c
+	return c
+}
+
+func join(h *Hub, c *Client, roomID string) {
+	data, _ := JSON.Marshal(&WSMessage{Type: EventJoinRoom, Payload: JoinRoomPayload{RoomID: roomID}})
+	h.HandleMessage(c, data)
+}
+
+type envelope struct {
+	Type    EventType       `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// events takes every frame queued for c without waiting.
+func events(c *Client) []envelope {
+	frames, _ := c.out.take()
+	out := make([]envelope, 0, len(frames))
+	for _, f := range frames {
+		var e envelope
+		if err := json.Unmarshal(f.data, &e); err == nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// expectEvent waits for c to be sent an event of type want, discarding
+// others, and decodes its payload into payload when it is not nil.
+func expectEvent(t *testing.T, c *Client, want EventType, payload interface{}) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		for _, e := range events(c) {
+			if e.Type != want {
+				continue
+			}
+			if payload != nil {
+				if err := json.Unmarshal(e.Payload, payload); err != nil {
+					t.Fatalf("decoding %s: %v", want, err)
+				}
+			}
+			return
+		}
+		select {
+		case <-c.out.ready:
+		case <-timeout:
+			t.Fatalf("%s: no %s event", c.User.ID, want)
+		}
+	}
+}
+
+// eventually polls cond until it holds or five seconds pass.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func roomCount(h *Hub) int {
+	n := 0
+	h.rooms.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
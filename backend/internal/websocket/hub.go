@@ -2,236 +2,515 @@ package websocket
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/automod"
 	"github.com/ilhammramadhan/gabble/internal/database"
 	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
+// Hub tracks connected clients and routes events to rooms. The client
+// registry is owned by the Run goroutine; each room is its own actor (see
+// Room), so joins, leaves and fan-out in one room never wait on another.
 type Hub struct {
-	Clients    map[*Client]bool
-	Rooms      map[string]map[*Client]bool
 	Register   chan *Client
 	Unregister chan *Client
 	DB         *database.DB
-	mu         sync.RWMutex
+	// Audit records moderation done over WebSockets and by automod. It may
+	// be nil.
+	Audit *audit.Logger
+
+	opts      Options
+	limiters  eventLimiters
+	admission admission
+
+	// clients and users are only touched by Run.
+	clients map[*Client]bool
+	users   map[string]*userPresence
+	// calls runs functions on the Run goroutine for code that needs to read
+	// the client registry.
+	calls chan func()
+
+	// rooms maps room IDs to live *Room actors.
+	rooms sync.Map
+	// policies maps room IDs to cached *roomPolicy settings.
+	policies      sync.Map
+	serverAutomod atomic.Pointer[automod.RuleSet]
+	repeats       *automod.Repeats
+
+	// shuttingDown is set by Shutdown; quit stops Run, which closes stopped
+	// on its way out.
+	shuttingDown atomic.Bool
+	quit         chan struct{}
+	stopped      chan struct{}
 }
 
-func NewHub(db *database.DB) *Hub {
+func NewHub(db *database.DB, auditLog *audit.Logger, opts Options) *Hub {
+	opts = opts.withDefaults()
 	return &Hub{
-		Clients:    make(map[*Client]bool),
-		Rooms:      make(map[string]map[*Client]bool),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		DB:         db,
+		Audit:      auditLog,
+		opts:       opts,
+		limiters:   newEventLimiters(opts),
+		repeats:    automod.NewRepeats(),
+		admission: admission{
+			users: make(map[string]int),
+			ips:   make(map[string]int),
+		},
+		clients: make(map[*Client]bool),
+		users:   make(map[string]*userPresence),
+		calls:   make(chan func()),
+		quit:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 }
 
 func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	sweep := time.NewTicker(presenceSweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.Register:
-			h.mu.Lock()
-			h.Clients[client] = true
-			h.mu.Unlock()
+			h.clients[client] = true
+			h.connect(client)
 
 		case client := <-h.Unregister:
-			h.mu.Lock()
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
+			if _, ok := h.clients[client]; ok {
+				delete(h.clients, client)
+				client.Close(websocket.CloseNormalClosure, "", false)
+				client.ticket.Release()
 
-				if client.RoomID != "" {
-					h.removeFromRoom(client, client.RoomID)
+				for _, roomID := range client.subscriptions() {
+					h.deliver(roomID, roomCommand{kind: cmdLeave, client: client}, false)
 				}
+				h.disconnect(client)
+			}
+
+		case fn := <-h.calls:
+			fn()
+
+		case <-sweep.C:
+			h.sweepPresence()
+
+		case <-h.quit:
+			h.flushLastSeen()
+			return
+		}
+	}
+}
+
+// call runs fn on the Run goroutine and waits for it to finish. Once Run
+// has stopped fn is not run at all.
+func (h *Hub) call(fn func()) {
+	done := make(chan struct{})
+	select {
+	case h.calls <- func() {
+		fn()
+		close(done)
+	}:
+		<-done
+	case <-h.stopped:
+	}
+}
+
+// Attach registers a newly connected client holding ticket, which may be
+// nil, from Admit. It reports false, and the caller should drop the
+// connection, if the hub is shutting down; the ticket is released either
+// way once the client is gone.
+func (h *Hub) Attach(client *Client, ticket *Ticket) bool {
+	client.ticket = ticket
+	if h.shuttingDown.Load() {
+		ticket.Release()
+		return false
+	}
+	select {
+	case h.Register <- client:
+	case <-h.stopped:
+		ticket.Release()
+		return false
+	}
+	// Loaded once registered, so a block made meanwhile reaches the client
+	// through SetBlocked if the load missed it.
+	h.loadBlocks(client)
+	return true
+}
+
+// Detach unregisters a client whose connection has ended.
+func (h *Hub) Detach(client *Client) {
+	select {
+	case h.Unregister <- client:
+	case <-h.stopped:
+	}
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func (h *Hub) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// deliver queues cmd in the room's mailbox, starting the room actor first
+// when create is set. Commands for rooms that do not exist are dropped
+// since there is nobody to receive them.
+func (h *Hub) deliver(roomID string, cmd roomCommand, create bool) {
+	for {
+		v, ok := h.rooms.Load(roomID)
+		if !ok {
+			if !create {
+				return
+			}
+			room := newRoom(h, roomID)
+			var loaded bool
+			if v, loaded = h.rooms.LoadOrStore(roomID, room); !loaded {
+				go room.run()
 			}
-			h.mu.Unlock()
 		}
+		room := v.(*Room)
+
+		// Registering as pending stops the room retiring between lookup and
+		// send. If it already retired, look it up again.
+		room.mu.Lock()
+		if room.stopped {
+			room.mu.Unlock()
+			continue
+		}
+		room.pending++
+		room.mu.Unlock()
+
+		room.mailbox <- cmd
+
+		room.mu.Lock()
+		room.pending--
+		room.mu.Unlock()
+		return
 	}
 }
 
-func (h *Hub) HandleMessage(client *Client, msg *WSMessage) {
+// HandleMessage decodes a frame received from client with the client's
+// codec and dispatches it.
+func (h *Hub) HandleMessage(client *Client, data []byte) {
+	msgType, payload, err := client.codec.decodeEnvelope(data)
+	if err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    "invalid_" + client.codec.Name(),
+			Message: "Message could not be decoded",
+		})
+		return
+	}
+	msg := &inbound{Type: msgType, payload: payload, codec: client.codec}
+
+	if !h.allowEvent(client, msg.Type) {
+		return
+	}
+
+	if msg.Type == EventHello {
+		h.handleHello(client, msg)
+		return
+	}
+	if client.handshakeRequired() {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeHandshakeRequired,
+			Message: "Send hello before any other event",
+			Request: msg.Type,
+		})
+		return
+	}
+
+	if msg.Type == EventActivity {
+		h.handleActivity(client, msg)
+		return
+	}
+
+	// Anything the user does counts as activity.
+	if client.touch() {
+		h.call(func() { h.refreshPresence(client.User.ID) })
+	}
+
 	switch msg.Type {
 	case EventJoinRoom:
 		h.handleJoinRoom(client, msg)
-	case EventLeaveRoom:
-		h.handleLeaveRoom(client, msg)
+	case EventLeaveRoom, EventUnsubscribe:
+		h.handleUnsubscribe(client, msg)
+	case EventSubscribe:
+		h.handleSubscribe(client, msg)
 	case EventSendMessage:
 		h.handleSendMessage(client, msg)
 	case EventTyping:
 		h.handleTyping(client, msg)
+	case EventReportMessage:
+		h.handleReportMessage(client, msg)
+	default:
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeUnsupportedEvent,
+			Message: "Unsupported event type",
+			Request: msg.Type,
+		})
 	}
 }
 
-func (h *Hub) handleJoinRoom(client *Client, msg *WSMessage) {
-	payloadBytes, _ := json.Marshal(msg.Payload)
+func (h *Hub) handleJoinRoom(client *Client, msg *inbound) {
 	var payload JoinRoomPayload
-	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
-		h.sendError(client, "Invalid payload")
+	if err := msg.decode(&payload); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidPayload,
+			Message: "Invalid payload",
+			Request: EventJoinRoom,
+		})
 		return
 	}
 
-	h.mu.Lock()
-	if client.RoomID != "" {
-		h.removeFromRoom(client, client.RoomID)
+	if h.shuttingDown.Load() {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeServerRestarting,
+			Message: "Server is restarting",
+			Request: EventJoinRoom,
+		})
+		return
 	}
 
-	if h.Rooms[payload.RoomID] == nil {
-		h.Rooms[payload.RoomID] = make(map[*Client]bool)
+	if payload.RoomID == "" {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidRequest,
+			Message: "Room ID is required",
+			Request: EventJoinRoom,
+		})
+		return
 	}
-	h.Rooms[payload.RoomID][client] = true
-	client.RoomID = payload.RoomID
-	h.mu.Unlock()
 
-	h.broadcastToRoom(payload.RoomID, &WSMessage{
-		Type: EventUserJoined,
-		Payload: UserEventPayload{
-			RoomID: payload.RoomID,
-			User:   client.User,
-		},
-	}, client)
+	if err := h.Join(client, payload.RoomID); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeTooManySubscriptions,
+			Message: err.Error(),
+			Request: EventJoinRoom,
+		})
+	}
+}
 
-	h.sendOnlineUsers(payload.RoomID)
+// Join subscribes client to roomID and focuses it. The previously focused
+// room stays subscribed but the client drops out of its presence.
+func (h *Hub) Join(client *Client, roomID string) error {
+	previous, err := client.focus(roomID)
+	if err != nil {
+		return err
+	}
+	if previous != "" && previous != roomID {
+		h.deliver(previous, roomCommand{kind: cmdBlur, client: client}, false)
+	}
+
+	h.deliver(roomID, roomCommand{kind: cmdFocus, client: client}, true)
+	return nil
 }
 
-func (h *Hub) handleLeaveRoom(client *Client, msg *WSMessage) {
-	payloadBytes, _ := json.Marshal(msg.Payload)
-	var payload LeaveRoomPayload
-	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+func (h *Hub) handleSubscribe(client *Client, msg *inbound) {
+	var payload SubscribePayload
+	if err := msg.decode(&payload); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidPayload,
+			Message: "Invalid payload",
+			Request: EventSubscribe,
+		})
 		return
 	}
 
-	h.mu.Lock()
-	h.removeFromRoom(client, payload.RoomID)
-	client.RoomID = ""
-	h.mu.Unlock()
+	if h.shuttingDown.Load() {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeServerRestarting,
+			Message: "Server is restarting",
+			Request: EventSubscribe,
+		})
+		return
+	}
 
-	h.broadcastToRoom(payload.RoomID, &WSMessage{
-		Type: EventUserLeft,
-		Payload: UserEventPayload{
-			RoomID: payload.RoomID,
-			User:   client.User,
-		},
-	}, nil)
+	if err := h.Subscribe(client, payload.rooms()...); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeTooManySubscriptions,
+			Message: err.Error(),
+			Request: EventSubscribe,
+		})
+	}
+}
 
-	h.sendOnlineUsers(payload.RoomID)
+// Subscribe adds roomIDs to the rooms client receives messages from,
+// without making it part of their presence.
+func (h *Hub) Subscribe(client *Client, roomIDs ...string) error {
+	for _, roomID := range roomIDs {
+		added, err := client.subscribe(roomID)
+		if err != nil {
+			return err
+		}
+		if added {
+			h.deliver(roomID, roomCommand{kind: cmdSubscribe, client: client}, true)
+		}
+	}
+	return nil
 }
 
-func (h *Hub) handleSendMessage(client *Client, msg *WSMessage) {
-	payloadBytes, _ := json.Marshal(msg.Payload)
-	var payload SendMessagePayload
-	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
-		h.sendError(client, "Invalid payload")
+func (h *Hub) handleUnsubscribe(client *Client, msg *inbound) {
+	var payload SubscribePayload
+	if err := msg.decode(&payload); err != nil {
 		return
 	}
 
-	if payload.Content == "" || payload.RoomID == "" {
-		h.sendError(client, "Message content and room ID are required")
+	for _, roomID := range payload.rooms() {
+		if client.unsubscribe(roomID) {
+			h.deliver(roomID, roomCommand{kind: cmdLeave, client: client}, false)
+		}
+	}
+}
+
+func (h *Hub) handleSendMessage(client *Client, msg *inbound) {
+	var payload SendMessagePayload
+	if err := msg.decode(&payload); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidPayload,
+			Message: "Invalid payload",
+			Request: EventSendMessage,
+		})
 		return
 	}
 
-	dbMsg, err := h.DB.CreateMessage(context.Background(), payload.RoomID, client.User.ID, payload.Content)
+	dbMsg, created, err := h.SendMessage(context.Background(), client.User, payload.RoomID, payload.Content, payload.ClientMsgID)
+	var rejected *SendError
+	if errors.As(err, &rejected) {
+		h.sendError(client, ErrorPayload{
+			Code:        rejected.Code,
+			Message:     rejected.Message,
+			Request:     EventSendMessage,
+			ClientMsgID: payload.ClientMsgID,
+			RetryAfter:  rejected.RetryAfter.Milliseconds(),
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("error creating message: %v", err)
-		h.sendError(client, "Failed to save message")
+		h.sendError(client, ErrorPayload{
+			Code:        ErrCodeInternal,
+			Message:     "Failed to save message",
+			Request:     EventSendMessage,
+			ClientMsgID: payload.ClientMsgID,
+		})
 		return
 	}
 
-	h.broadcastToRoom(payload.RoomID, &WSMessage{
-		Type: EventMessage,
-		Payload: MessagePayload{
-			ID:        dbMsg.ID,
-			RoomID:    dbMsg.RoomID,
-			Content:   dbMsg.Content,
-			User:      client.User,
-			CreatedAt: dbMsg.CreatedAt,
+	client.send(&WSMessage{
+		Type: EventAck,
+		Payload: AckPayload{
+			ClientMsgID: payload.ClientMsgID,
+			ID:          dbMsg.ID,
+			RoomID:      dbMsg.RoomID,
+			Seq:         dbMsg.Seq,
+			CreatedAt:   dbMsg.CreatedAt,
+			Duplicate:   !created,
 		},
-	}, nil)
+	}, false)
 }
 
-func (h *Hub) handleTyping(client *Client, msg *WSMessage) {
-	payloadBytes, _ := json.Marshal(msg.Payload)
-	var payload TypingPayload
-	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
-		return
-	}
-
-	h.broadcastToRoom(payload.RoomID, &WSMessage{
-		Type: EventTyping,
-		Payload: TypingEventPayload{
-			RoomID:   payload.RoomID,
-			User:     client.User,
-			IsTyping: payload.IsTyping,
-		},
-	}, client)
+// SendError is a message SendMessage refused to store, or a report
+// ReportMessage refused to file. Code is reported to WebSocket clients as
+// the error code.
+type SendError struct {
+	Code    string
+	Message string
+	// RetryAfter is set when the same message may be sent after that long.
+	RetryAfter time.Duration
 }
 
-func (h *Hub) removeFromRoom(client *Client, roomID string) {
-	if room, ok := h.Rooms[roomID]; ok {
-		delete(room, client)
-		if len(room) == 0 {
-			delete(h.Rooms, roomID)
-		}
-	}
+func (e *SendError) Error() string {
+	return e.Message
 }
 
-func (h *Hub) broadcastToRoom(roomID string, msg *WSMessage, exclude *Client) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// SendMessage stores a message from user and broadcasts it to the room,
+// subject to the room's settings. A retried send with a clientMsgID already
+// stored gets the original message back with created false, and is not
+// broadcast again.
+func (h *Hub) SendMessage(ctx context.Context, user *models.User, roomID, content, clientMsgID string) (*models.Message, bool, error) {
+	if content == "" || roomID == "" {
+		return nil, false, &SendError{Code: ErrCodeInvalidRequest, Message: "Message content and room ID are required"}
+	}
+	if len(clientMsgID) > maxClientMsgIDLength {
+		return nil, false, &SendError{Code: ErrCodeInvalidRequest, Message: "client_msg_id is too long"}
+	}
 
-	room, ok := h.Rooms[roomID]
-	if !ok {
-		return
+	// A retry of a message that was stored is acked without being screened
+	// again, so it is not held to slow mode or counted as a repeat.
+	if clientMsgID != "" {
+		msg, err := h.DB.GetMessageByClientMsgID(ctx, user.ID, clientMsgID)
+		if err == nil {
+			return msg, false, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, err
+		}
 	}
 
-	data, err := json.Marshal(msg)
+	stored, hits, release, err := h.screen(ctx, user, roomID, content, clientMsgID)
 	if err != nil {
-		return
+		return nil, false, err
 	}
 
-	for client := range room {
-		if client != exclude {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(room, client)
-			}
-		}
+	msg, created, err := h.DB.CreateMessage(ctx, roomID, user.ID, stored, clientMsgID)
+	if err != nil || !created {
+		release()
+		return msg, created, err
+	}
+	if len(hits) > 0 {
+		h.recordHits(ctx, user, roomID, msg.ID, content, hits)
 	}
+
+	h.broadcastToRoom(roomID, &WSMessage{
+		Type: EventMessage,
+		Payload: MessagePayload{
+			ID:          msg.ID,
+			RoomID:      msg.RoomID,
+			Seq:         msg.Seq,
+			ClientMsgID: msg.ClientMsgID,
+			Content:     msg.Content,
+			User:        user,
+			CreatedAt:   msg.CreatedAt,
+		},
+	}, user.ID)
+	return msg, true, nil
 }
 
-func (h *Hub) sendOnlineUsers(roomID string) {
-	h.mu.RLock()
-	room, ok := h.Rooms[roomID]
-	if !ok {
-		h.mu.RUnlock()
+func (h *Hub) handleTyping(client *Client, msg *inbound) {
+	var payload TypingPayload
+	if err := msg.decode(&payload); err != nil {
 		return
 	}
 
-	users := make([]*models.User, 0, len(room))
-	for client := range room {
-		users = append(users, client.User)
-	}
-	h.mu.RUnlock()
+	// The room keeps the typing state and decides what to send; see
+	// typing.go.
+	h.deliver(payload.RoomID, roomCommand{kind: cmdTyping, client: client, typing: payload.IsTyping}, false)
+}
 
-	msg := &WSMessage{
-		Type: EventOnlineUsers,
-		Payload: OnlineUsersPayload{
-			RoomID: roomID,
-			Users:  users,
-		},
-	}
+// Broadcast sends msg to every subscriber of roomID, for events that
+// originate outside a WebSocket connection.
+func (h *Hub) Broadcast(roomID string, msg *WSMessage) {
+	h.broadcastToRoom(roomID, msg, "")
+}
 
-	h.broadcastToRoom(roomID, msg, nil)
+// broadcastToRoom hands msg to the room actor for fan-out, which encodes it
+// once per codec in use. A message sent by senderID also ends that user's
+// typing indicator.
+func (h *Hub) broadcastToRoom(roomID string, msg *WSMessage, senderID string) {
+	h.deliver(roomID, roomCommand{kind: cmdBroadcast, senderID: senderID, out: newOutbound(msg)}, false)
 }
 
-func (h *Hub) sendError(client *Client, message string) {
-	data, _ := json.Marshal(&WSMessage{
+// sendError reports a failed request to the client.
+func (h *Hub) sendError(client *Client, e ErrorPayload) {
+	client.send(&WSMessage{
 		Type:    EventError,
-		Payload: ErrorPayload{Message: message},
-	})
-	client.Send <- data
+		Payload: e,
+	}, false)
 }
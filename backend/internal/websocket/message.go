@@ -13,11 +13,29 @@ const (
 	EventLeaveRoom   EventType = "leave_room"
 	EventSendMessage EventType = "send_message"
 	EventTyping      EventType = "typing"
+	EventSubscribe   EventType = "subscribe"
+	EventUnsubscribe EventType = "unsubscribe"
+	EventActivity    EventType = "activity"
+	EventHello       EventType = "hello"
+	EventWelcome     EventType = "welcome"
 	EventMessage     EventType = "message"
 	EventUserJoined  EventType = "user_joined"
 	EventUserLeft    EventType = "user_left"
 	EventOnlineUsers EventType = "online_users"
 	EventError       EventType = "error"
+	EventAck         EventType = "ack"
+
+	EventReportMessage  EventType = "report_message"
+	EventReportReceived EventType = "report_received"
+	EventMessageDeleted EventType = "message_deleted"
+	EventPinsUpdated    EventType = "pins_updated"
+
+	EventSystemAnnouncement  EventType = "system_announcement"
+	EventRoomDeleted         EventType = "room_deleted"
+	EventServerRestarting    EventType = "server_restarting"
+	EventPresenceChanged     EventType = "presence_changed"
+	EventTypingUsers         EventType = "typing_users"
+	EventRoomSettingsUpdated EventType = "room_settings_updated"
 )
 
 type WSMessage struct {
@@ -29,13 +47,35 @@ type JoinRoomPayload struct {
 	RoomID string `json:"room_id"`
 }
 
-type LeaveRoomPayload struct {
-	RoomID string `json:"room_id"`
+// SubscribePayload is used by subscribe, unsubscribe and leave_room, and
+// names either one room or several.
+type SubscribePayload struct {
+	RoomID  string   `json:"room_id"`
+	RoomIDs []string `json:"room_ids"`
+}
+
+func (p SubscribePayload) rooms() []string {
+	rooms := make([]string, 0, len(p.RoomIDs)+1)
+	if p.RoomID != "" {
+		rooms = append(rooms, p.RoomID)
+	}
+	for _, roomID := range p.RoomIDs {
+		if roomID != "" {
+			rooms = append(rooms, roomID)
+		}
+	}
+	return rooms
 }
 
+// maxClientMsgIDLength matches the messages.client_msg_id column.
+const maxClientMsgIDLength = 64
+
 type SendMessagePayload struct {
 	RoomID  string `json:"room_id"`
 	Content string `json:"content"`
+	// ClientMsgID is an optional client-generated ID, unique per user,
+	// that makes retries idempotent and correlates the ack or error.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
 }
 
 type TypingPayload struct {
@@ -44,11 +84,24 @@ type TypingPayload struct {
 }
 
 type MessagePayload struct {
-	ID        string       `json:"id"`
-	RoomID    string       `json:"room_id"`
-	Content   string       `json:"content"`
-	User      *models.User `json:"user"`
-	CreatedAt time.Time    `json:"created_at"`
+	ID          string       `json:"id"`
+	RoomID      string       `json:"room_id"`
+	Seq         int64        `json:"seq"`
+	ClientMsgID string       `json:"client_msg_id,omitempty"`
+	Content     string       `json:"content"`
+	User        *models.User `json:"user"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// AckPayload confirms a send_message to the sender. Duplicate is set when
+// the client_msg_id had already been stored.
+type AckPayload struct {
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	ID          string    `json:"id"`
+	RoomID      string    `json:"room_id"`
+	Seq         int64     `json:"seq"`
+	CreatedAt   time.Time `json:"created_at"`
+	Duplicate   bool      `json:"duplicate"`
 }
 
 type UserEventPayload struct {
@@ -62,11 +115,69 @@ type TypingEventPayload struct {
 	IsTyping bool         `json:"is_typing"`
 }
 
+type TypingUsersPayload struct {
+	RoomID string         `json:"room_id"`
+	Users  []*models.User `json:"users"`
+}
+
 type OnlineUsersPayload struct {
 	RoomID string         `json:"room_id"`
 	Users  []*models.User `json:"users"`
 }
 
 type ErrorPayload struct {
-	Message string `json:"message"`
+	Code        string    `json:"code"`
+	Message     string    `json:"message"`
+	Request     EventType `json:"request,omitempty"`
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	// RetryAfter, in milliseconds, is set when the request may succeed if
+	// retried after that long.
+	RetryAfter int64 `json:"retry_after_ms,omitempty"`
+}
+
+type SystemAnnouncementPayload struct {
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReportMessagePayload struct {
+	MessageID string `json:"message_id"`
+	Reason    string `json:"reason"`
+}
+
+type ReportReceivedPayload struct {
+	ReportID  string `json:"report_id"`
+	MessageID string `json:"message_id"`
+}
+
+type MessageDeletedPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+}
+
+type PinsUpdatedPayload struct {
+	RoomID string       `json:"room_id"`
+	Pins   []models.Pin `json:"pins"`
+}
+
+type RoomDeletedPayload struct {
+	RoomID string `json:"room_id"`
+}
+
+type ServerRestartingPayload struct {
+	// ReconnectAfter is how long clients should wait before reconnecting,
+	// in milliseconds. It is jittered per connection so clients do not all
+	// come back at once.
+	ReconnectAfter int64 `json:"reconnect_after_ms"`
+}
+
+// ActivityPayload is sent by clients as the user interacts, and with Idle
+// set when they stop (for example when the tab is hidden).
+type ActivityPayload struct {
+	Idle bool `json:"idle"`
+}
+
+type PresenceChangedPayload struct {
+	RoomID string `json:"room_id"`
+	Presence
 }
@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxReportReasonLength = 500
+
+func (h *Hub) handleReportMessage(client *Client, msg *inbound) {
+	var payload ReportMessagePayload
+	if err := msg.decode(&payload); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidPayload,
+			Message: "Invalid payload",
+			Request: EventReportMessage,
+		})
+		return
+	}
+
+	report, err := h.ReportMessage(context.Background(), client.User, payload.MessageID, payload.Reason)
+	var rejected *SendError
+	if errors.As(err, &rejected) {
+		h.sendError(client, ErrorPayload{
+			Code:    rejected.Code,
+			Message: rejected.Message,
+			Request: EventReportMessage,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error creating report: %v", err)
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInternal,
+			Message: "Failed to save report",
+			Request: EventReportMessage,
+		})
+		return
+	}
+
+	h.audit(context.Background(), client.User, audit.Event{
+		Action:     audit.ActionReportCreate,
+		TargetType: audit.TargetReport,
+		TargetID:   report.ID,
+		Metadata:   map[string]interface{}{"message_id": report.MessageID, "room_id": report.RoomID},
+	})
+
+	client.send(&WSMessage{
+		Type: EventReportReceived,
+		Payload: ReportReceivedPayload{
+			ReportID:  report.ID,
+			MessageID: report.MessageID,
+		},
+	}, false)
+}
+
+// ReportMessage files user's report of a message for the room's moderators
+// to review.
+func (h *Hub) ReportMessage(ctx context.Context, user *models.User, messageID, reason string) (*models.MessageReport, error) {
+	if messageID == "" || reason == "" {
+		return nil, &SendError{Code: ErrCodeInvalidRequest, Message: "Message ID and reason are required"}
+	}
+	if len([]rune(reason)) > maxReportReasonLength {
+		return nil, &SendError{Code: ErrCodeInvalidRequest, Message: "Reason is too long"}
+	}
+
+	msg, err := h.DB.GetMessageByID(ctx, messageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &SendError{Code: ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.UserID == user.ID {
+		return nil, &SendError{Code: ErrCodeInvalidRequest, Message: "You cannot report your own message"}
+	}
+
+	report, err := h.DB.CreateReport(ctx, msg, user.ID, reason)
+	if errors.Is(err, database.ErrConflict) {
+		return nil, &SendError{Code: ErrCodeAlreadyReported, Message: "You have already reported this message"}
+	}
+	return report, err
+}
+
+// DeleteMessage removes a message and tells the room's subscribers to
+// drop it, and to update their pins if it was pinned.
+func (h *Hub) DeleteMessage(ctx context.Context, msg *models.Message) (bool, error) {
+	deleted, unpinned, err := h.DB.DeleteMessage(ctx, msg.ID)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	h.Broadcast(msg.RoomID, &WSMessage{
+		Type: EventMessageDeleted,
+		Payload: MessageDeletedPayload{
+			RoomID:    msg.RoomID,
+			MessageID: msg.ID,
+		},
+	})
+	if unpinned {
+		if _, err := h.PinsUpdated(ctx, msg.RoomID); err != nil {
+			log.Printf("error sending pins for room %s: %v", msg.RoomID, err)
+		}
+	}
+	return true, nil
+}
+
+// PinsUpdated sends a room its current list of pins, and returns it.
+func (h *Hub) PinsUpdated(ctx context.Context, roomID string) ([]models.Pin, error) {
+	pins, err := h.DB.GetPins(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if pins == nil {
+		pins = []models.Pin{}
+	}
+
+	h.Broadcast(roomID, &WSMessage{
+		Type:    EventPinsUpdated,
+		Payload: PinsUpdatedPayload{RoomID: roomID, Pins: pins},
+	})
+	return pins, nil
+}
+
+// audit records an event that did not come from an HTTP request; a nil
+// actor is the server itself.
+func (h *Hub) audit(ctx context.Context, actor *models.User, event audit.Event) {
+	if h.Audit != nil {
+		h.Audit.RecordSystem(ctx, actor, event)
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/ratelimit"
+)
+
+// Options configures a Hub's connections. Zero fields, other than
+// CompressionThreshold, take the values in DefaultOptions.
+type Options struct {
+	SlowConsumerPolicy SlowConsumerPolicy
+	// MaxMessageSize is the largest frame, in bytes, a client may send.
+	MaxMessageSize int64
+	// SendBufferSize is how many outbound frames a client may have queued
+	// before the slow consumer policy applies.
+	SendBufferSize int
+	WriteWait      time.Duration
+	// PongWait is how long a connection may stay silent, pongs included,
+	// before it is dropped. Pings are sent at nine tenths of it.
+	PongWait time.Duration
+	// CompressionThreshold is the smallest frame, in bytes, compressed for
+	// clients that negotiated permessage-deflate; 0 compresses every frame.
+	CompressionThreshold int
+
+	// MaxConnections, MaxConnectionsPerUser and MaxConnectionsPerIP cap
+	// the connections Admit lets in; zero means no limit. With EvictOldest
+	// a user at their limit replaces their oldest connection instead of
+	// being refused.
+	MaxConnections        int
+	MaxConnectionsPerUser int
+	MaxConnectionsPerIP   int
+	EvictOldest           bool
+
+	// EventLimits rate limits the events each user sends, by type, and
+	// DefaultEventLimit covers any other type. Zero limits allow everything.
+	EventLimits       map[EventType]ratelimit.Limit
+	DefaultEventLimit ratelimit.Limit
+	// AbuseLimit is how many rate limited events a user may send before
+	// the offending connection is closed.
+	AbuseLimit ratelimit.Limit
+
+	// AutomodMuteDuration is how long the mute action of an
+	// auto-moderation rule lasts.
+	AutomodMuteDuration time.Duration
+}
+
+var DefaultOptions = Options{
+	SlowConsumerPolicy:   PolicyDropTyping,
+	MaxMessageSize:       4096,
+	SendBufferSize:       256,
+	WriteWait:            10 * time.Second,
+	PongWait:             60 * time.Second,
+	CompressionThreshold: 512,
+	AutomodMuteDuration:  10 * time.Minute,
+}
+
+func (o Options) withDefaults() Options {
+	if o.SlowConsumerPolicy == "" {
+		o.SlowConsumerPolicy = DefaultOptions.SlowConsumerPolicy
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = DefaultOptions.MaxMessageSize
+	}
+	if o.SendBufferSize <= 0 {
+		o.SendBufferSize = DefaultOptions.SendBufferSize
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = DefaultOptions.WriteWait
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = DefaultOptions.PongWait
+	}
+	if o.CompressionThreshold < 0 {
+		o.CompressionThreshold = DefaultOptions.CompressionThreshold
+	}
+	if o.AutomodMuteDuration <= 0 {
+		o.AutomodMuteDuration = DefaultOptions.AutomodMuteDuration
+	}
+	return o
+}
+
+func (o Options) pingPeriod() time.Duration {
+	return o.PongWait * 9 / 10
+}
+
+// Options returns the options the hub was created with, defaults applied.
+func (h *Hub) Options() Options {
+	return h.opts
+}
@@ -0,0 +1,184 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/metrics"
+)
+
+// SlowConsumerPolicy decides what happens when a client's send buffer is
+// full.
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest discards the oldest queued frame to make room.
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyDropTyping discards typing indicators, queued or incoming, to
+	// make room, and disconnects the client if only other frames are queued.
+	PolicyDropTyping SlowConsumerPolicy = "drop_typing"
+	// PolicyDisconnect closes the connection with CloseTryAgainLater.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+var (
+	framesDropped = metrics.NewCounterVec(
+		"gabble_ws_frames_dropped_total",
+		"Outbound WebSocket frames discarded because a client's send buffer was full.",
+		"reason",
+	)
+	slowConsumerDisconnects = metrics.NewCounter(
+		"gabble_ws_slow_consumer_disconnects_total",
+		"Connections closed because the client could not keep up.",
+	)
+)
+
+type frame struct {
+	data []byte
+	// droppable marks low-value frames, such as typing indicators, that
+	// PolicyDropTyping may discard.
+	droppable bool
+	// seq is the seq of a chat message, which SSE sends as the event ID,
+	// and 0 for any other event.
+	seq int64
+}
+
+// outbox is a client's bounded queue of outbound frames. It is the only
+// thing that decides a connection is closed: closing is idempotent and
+// safe from any goroutine, and pushes after close are ignored, so no
+// sender can write to or close a dead connection.
+type outbox struct {
+	mu     sync.Mutex
+	frames []frame
+	limit  int
+	policy SlowConsumerPolicy
+
+	closed      bool
+	closeCode   int
+	closeReason string
+
+	// ready has capacity one and is signalled whenever frames are queued
+	// or the outbox is closed.
+	ready chan struct{}
+}
+
+func newOutbox(limit int, policy SlowConsumerPolicy) *outbox {
+	return &outbox{
+		frames: make([]frame, 0, limit),
+		limit:  limit,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push queues f, applying the slow consumer policy when full. It never
+// blocks and reports whether f was queued.
+func (o *outbox) push(f frame) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return false
+	}
+
+	if len(o.frames) >= o.limit {
+		switch o.policy {
+		case PolicyDropOldest:
+			o.frames = append(o.frames[:0], o.frames[1:]...)
+			framesDropped.With("oldest").Inc()
+
+		case PolicyDropTyping:
+			if f.droppable {
+				framesDropped.With("typing").Inc()
+				return false
+			}
+			if !o.dropQueuedTyping() {
+				o.disconnectLocked()
+				return false
+			}
+			framesDropped.With("typing").Inc()
+
+		default:
+			o.disconnectLocked()
+			return false
+		}
+	}
+
+	o.frames = append(o.frames, f)
+	o.signal()
+	return true
+}
+
+func (o *outbox) dropQueuedTyping() bool {
+	for i, queued := range o.frames {
+		if queued.droppable {
+			o.frames = append(o.frames[:i], o.frames[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (o *outbox) disconnectLocked() {
+	slowConsumerDisconnects.Inc()
+	framesDropped.With("disconnect").Add(int64(len(o.frames)))
+	o.frames = o.frames[:0]
+	o.closeLocked(websocket.CloseTryAgainLater, "slow consumer")
+}
+
+// close stops accepting frames. Frames already queued are still delivered
+// before the close frame unless discard is set.
+func (o *outbox) close(code int, reason string, discard bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if discard {
+		o.frames = o.frames[:0]
+	}
+	o.closeLocked(code, reason)
+}
+
+func (o *outbox) closeLocked(code int, reason string) {
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.closeCode = code
+	o.closeReason = reason
+	o.signal()
+}
+
+func (o *outbox) isClosed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closed
+}
+
+// take removes and returns everything queued, along with whether the
+// outbox has been closed.
+func (o *outbox) take() (frames []frame, closed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	frames = o.frames
+	o.frames = make([]frame, 0, o.limit)
+	return frames, o.closed
+}
+
+// closeStatus returns the code and reason the outbox was closed with.
+func (o *outbox) closeStatus() (int, string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closeCode, o.closeReason
+}
+
+func (o *outbox) closeMessage() []byte {
+	return websocket.FormatCloseMessage(o.closeStatus())
+}
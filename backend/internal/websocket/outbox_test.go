@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOutboxSlowConsumerPolicy(t *testing.T) {
+	msg := frame{data: []byte("msg")}
+	typing := frame{data: []byte("typing"), droppable: true}
+
+	tests := []struct {
+		name       string
+		policy     SlowConsumerPolicy
+		queued     []frame
+		push       frame
+		wantQueued bool
+		wantFrames []string
+		wantClosed bool
+	}{
+		{"room to spare", PolicyDisconnect, []frame{msg}, msg, true, []string{"msg", "msg"}, false},
+		{"drop oldest", PolicyDropOldest, []frame{{data: []byte("a")}, {data: []byte("b")}}, msg, true, []string{"b", "msg"}, false},
+		{"drop incoming typing", PolicyDropTyping, []frame{msg, msg}, typing, false, []string{"msg", "msg"}, false},
+		{"drop queued typing", PolicyDropTyping, []frame{typing, msg}, msg, true, []string{"msg", "msg"}, false},
+		{"drop typing disconnects", PolicyDropTyping, []frame{msg, msg}, msg, false, nil, true},
+		{"disconnect", PolicyDisconnect, []frame{msg, msg}, msg, false, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOutbox(2, tt.policy)
+			for _, f := range tt.queued {
+				if !o.push(f) {
+					t.Fatal("push into an outbox with room failed")
+				}
+			}
+
+			if got := o.push(tt.push); got != tt.wantQueued {
+				t.Errorf("push = %v, want %v", got, tt.wantQueued)
+			}
+			frames, closed := o.take()
+			var got []string
+			for _, f := range frames {
+				got = append(got, string(f.data))
+			}
+			if len(got) != len(tt.wantFrames) {
+				t.Fatalf("frames = %q, want %q", got, tt.wantFrames)
+			}
+			for i := range got {
+				if got[i] != tt.wantFrames[i] {
+					t.Fatalf("frames = %q, want %q", got, tt.wantFrames)
+				}
+			}
+			if closed != tt.wantClosed {
+				t.Errorf("closed = %v, want %v", closed, tt.wantClosed)
+			}
+			if closed {
+				if code, _ := o.closeStatus(); code != websocket.CloseTryAgainLater {
+					t.Errorf("close code = %d, want %d", code, websocket.CloseTryAgainLater)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxClose(t *testing.T) {
+	o := newOutbox(4, PolicyDisconnect)
+	o.push(frame{data: []byte("queued")})
+
+	o.close(websocket.CloseGoingAway, "bye", false)
+	o.close(websocket.CloseInternalServerErr, "again", false)
+	if o.push(frame{data: []byte("late")}) {
+		t.Error("push after close succeeded")
+	}
+
+	frames, closed := o.take()
+	if !closed || len(frames) != 1 {
+		t.Fatalf("take = %d frames, closed %v; want the queued frame and closed", len(frames), closed)
+	}
+	if code, reason := o.closeStatus(); code != websocket.CloseGoingAway || reason != "bye" {
+		t.Errorf("close status = %d %q, want the first close", code, reason)
+	}
+
+	o = newOutbox(4, PolicyDisconnect)
+	o.push(frame{data: []byte("queued")})
+	o.close(websocket.CloseGoingAway, "bye", true)
+	if frames, _ := o.take(); len(frames) != 0 {
+		t.Errorf("discarding close left %d frames", len(frames))
+	}
+}
+
+func TestOutboxConcurrent(t *testing.T) {
+	const writers, perWriter = 8, 1000
+	o := newOutbox(writers*perWriter, PolicyDisconnect)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				o.push(frame{data: []byte("x")})
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		o.close(websocket.CloseNormalClosure, "", false)
+		close(done)
+	}()
+
+	received := 0
+	for {
+		<-o.ready
+		frames, closed := o.take()
+		received += len(frames)
+		if closed {
+			// The close is signalled after the last push, but frames pushed
+			// between the two takes may still be queued.
+			frames, _ = o.take()
+			received += len(frames)
+			break
+		}
+	}
+	<-done
+	if received != writers*perWriter {
+		t.Errorf("received %d frames, want %d", received, writers*perWriter)
+	}
+}
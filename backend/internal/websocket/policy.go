@@ -0,0 +1,349 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ilhammramadhan/gabble/internal/audit"
+	"github.com/ilhammramadhan/gabble/internal/automod"
+	"github.com/ilhammramadhan/gabble/internal/metrics"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var automodHits = metrics.NewCounterVec(
+	"gabble_automod_hits_total",
+	"Messages matched by auto-moderation rules.",
+	"action",
+)
+
+// roomPolicy enforces a room's posting settings, auto-moderation rules and
+// mutes. It is cached per room on first send and kept until the room is
+// closed; changes are applied to the cached copy as they are saved.
+type roomPolicy struct {
+	settings atomic.Pointer[models.RoomSettings]
+	rules    atomic.Pointer[automod.RuleSet]
+
+	mu sync.Mutex
+	// lastPost is when each user last posted, for slow mode, and mutes
+	// when each muted user may post again.
+	lastPost map[string]time.Time
+	mutes    map[string]time.Time
+	prunedAt time.Time
+}
+
+func (h *Hub) roomPolicy(ctx context.Context, roomID string) (*roomPolicy, error) {
+	if p, ok := h.policies.Load(roomID); ok {
+		return p.(*roomPolicy), nil
+	}
+
+	settings, err := h.DB.GetRoomSettings(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := h.DB.GetAutomodRules(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	mutes, err := h.DB.GetActiveRoomMutes(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &roomPolicy{lastPost: make(map[string]time.Time), mutes: mutes}
+	p.settings.Store(settings)
+	p.rules.Store(automod.Compile(rules))
+	actual, _ := h.policies.LoadOrStore(roomID, p)
+	return actual.(*roomPolicy), nil
+}
+
+// serverRules returns the server-wide auto-moderation rules, loading them
+// on first use.
+func (h *Hub) serverRules(ctx context.Context) (*automod.RuleSet, error) {
+	if rules := h.serverAutomod.Load(); rules != nil {
+		return rules, nil
+	}
+	rules, err := h.DB.GetAutomodRules(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	set := automod.Compile(rules)
+	h.serverAutomod.Store(set)
+	return set, nil
+}
+
+// SetRoomSettings applies settings that have just been saved and tells the
+// room's subscribers about them.
+func (h *Hub) SetRoomSettings(settings *models.RoomSettings) {
+	if p, ok := h.policies.Load(settings.RoomID); ok {
+		p.(*roomPolicy).settings.Store(settings)
+	}
+	h.Broadcast(settings.RoomID, &WSMessage{
+		Type:    EventRoomSettingsUpdated,
+		Payload: settings,
+	})
+}
+
+// ForgetRoomSettings drops the cached settings for a room, such as after
+// its ownership changes, so the next send reloads them.
+func (h *Hub) ForgetRoomSettings(roomID string) {
+	h.policies.Delete(roomID)
+}
+
+// ReloadAutomodRules rereads a room's auto-moderation rules after they
+// change, or the server-wide rules when roomID is empty.
+func (h *Hub) ReloadAutomodRules(ctx context.Context, roomID string) error {
+	rules, err := h.DB.GetAutomodRules(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if roomID == "" {
+		h.serverAutomod.Store(automod.Compile(rules))
+	} else if p, ok := h.policies.Load(roomID); ok {
+		p.(*roomPolicy).rules.Store(automod.Compile(rules))
+	}
+	return nil
+}
+
+// MuteUser stops userID posting in a room for d. byID is the moderator
+// responsible, or empty for auto-moderation.
+func (h *Hub) MuteUser(ctx context.Context, roomID, userID string, d time.Duration, reason, byID string) error {
+	until := time.Now().Add(d)
+	err := h.DB.MuteUser(ctx, &models.RoomMute{
+		RoomID:     roomID,
+		UserID:     userID,
+		MutedUntil: until,
+		Reason:     reason,
+		CreatedBy:  byID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if p, ok := h.policies.Load(roomID); ok {
+		p := p.(*roomPolicy)
+		p.mu.Lock()
+		if until.After(p.mutes[userID]) {
+			p.mutes[userID] = until
+		}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// screen applies the room's settings and the auto-moderation rules to a
+// message from user. It returns the content to store, masked as the rules
+// say, the hits to record once it is stored and a release func to call if
+// it is not stored after all, or a *SendError if the message may not be
+// posted.
+func (h *Hub) screen(ctx context.Context, user *models.User, roomID, content, clientMsgID string) (string, []automod.Hit, func(), error) {
+	p, err := h.roomPolicy(ctx, roomID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, nil, &SendError{Code: ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	now := time.Now()
+	if err := p.check(user, content, now); err != nil {
+		return "", nil, nil, err
+	}
+	if p.settings.Load().CanModerate(user) {
+		return content, nil, func() {}, nil
+	}
+
+	serverRules, err := h.serverRules(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// Slow mode comes first so a message it holds back is not counted
+	// towards the repeat rules, and a message refused or not stored is taken
+	// back out of the count.
+	release, err := p.wait(user, now)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	repeats, undoRepeat := h.repeats.Add(user.ID, clientMsgID, content, now)
+	verdict := automod.Evaluate(automod.Input{
+		Content: content,
+		Repeats: repeats,
+	}, serverRules, p.rules.Load())
+
+	switch verdict.Action {
+	case automod.ActionReject:
+		release()
+		undoRepeat()
+		h.recordHits(ctx, user, roomID, "", content, verdict.Hits)
+		return "", nil, nil, &SendError{Code: ErrCodeContentRejected, Message: "Your message was blocked by the moderation rules"}
+	case automod.ActionMute:
+		release()
+		undoRepeat()
+		h.recordHits(ctx, user, roomID, "", content, verdict.Hits)
+		if err := h.MuteUser(ctx, roomID, user.ID, h.opts.AutomodMuteDuration, "automod", ""); err != nil {
+			log.Printf("error muting user %s: %v", user.ID, err)
+		} else {
+			h.audit(ctx, nil, audit.Event{
+				Action:     audit.ActionUserMute,
+				TargetType: audit.TargetUser,
+				TargetID:   user.ID,
+				Metadata: map[string]interface{}{
+					"room_id":  roomID,
+					"duration": h.opts.AutomodMuteDuration.String(),
+					"reason":   "automod",
+					"rule_ids": ruleIDs(verdict.Hits),
+				},
+			})
+		}
+		return "", nil, nil, &SendError{
+			Code:       ErrCodeMuted,
+			Message:    fmt.Sprintf("Your message was blocked by the moderation rules and you are muted in this room for %s", h.opts.AutomodMuteDuration),
+			RetryAfter: h.opts.AutomodMuteDuration,
+		}
+	}
+	return verdict.Content, verdict.Hits, func() {
+		release()
+		undoRepeat()
+	}, nil
+}
+
+// recordHits stores what the rules matched for moderators to review. The
+// content is the message as sent, before any masking.
+func (h *Hub) recordHits(ctx context.Context, user *models.User, roomID, messageID, content string, hits []automod.Hit) {
+	records := make([]models.AutomodHit, len(hits))
+	for i, hit := range hits {
+		automodHits.With(hit.Rule.Action).Inc()
+		records[i] = models.AutomodHit{
+			RuleID:    hit.Rule.ID,
+			RoomID:    roomID,
+			UserID:    user.ID,
+			MessageID: messageID,
+			Kind:      hit.Rule.Kind,
+			Action:    hit.Rule.Action,
+			Content:   content,
+		}
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := h.DB.CreateAutomodHits(ctx, records); err != nil {
+		log.Printf("error recording automod hits: %v", err)
+	}
+	if messageID == "" {
+		return
+	}
+
+	// Flagged messages join the room's report queue.
+	for _, hit := range hits {
+		if hit.Rule.Action != automod.ActionFlag {
+			continue
+		}
+		msg := &models.Message{ID: messageID, RoomID: roomID, UserID: user.ID, Content: content}
+		if _, err := h.DB.CreateReport(ctx, msg, "", "automod: "+hit.Rule.Kind+" rule"); err != nil {
+			log.Printf("error reporting flagged message %s: %v", messageID, err)
+		}
+		return
+	}
+}
+
+// check applies the room's settings, other than slow mode, to a message.
+// Moderators are exempt from all of it except a deny link policy.
+func (p *roomPolicy) check(user *models.User, content string, now time.Time) error {
+	s := p.settings.Load()
+	if s.LinkPolicy == models.LinkPolicyDeny && automod.ContainsLink(content) {
+		return &SendError{Code: ErrCodeLinksNotAllowed, Message: "Links are not allowed in this room"}
+	}
+	if s.CanModerate(user) {
+		return nil
+	}
+
+	p.mu.Lock()
+	until, muted := p.mutes[user.ID]
+	if muted && !now.Before(until) {
+		delete(p.mutes, user.ID)
+		muted = false
+	}
+	p.mu.Unlock()
+	if muted {
+		wait := until.Sub(now)
+		return &SendError{
+			Code:       ErrCodeMuted,
+			Message:    fmt.Sprintf("You are muted in this room; you can post again in %s", wait.Round(time.Second)),
+			RetryAfter: wait,
+		}
+	}
+
+	if s.ReadOnly {
+		return &SendError{Code: ErrCodeReadOnly, Message: "Only moderators can post in this room"}
+	}
+	if s.MaxMessageLength > 0 && utf8.RuneCountInString(content) > s.MaxMessageLength {
+		return &SendError{
+			Code:    ErrCodeMessageTooLong,
+			Message: fmt.Sprintf("Messages in this room are limited to %d characters", s.MaxMessageLength),
+		}
+	}
+	if s.LinkPolicy == models.LinkPolicyModerators && automod.ContainsLink(content) {
+		return &SendError{Code: ErrCodeLinksNotAllowed, Message: "Only moderators can post links in this room"}
+	}
+	return nil
+}
+
+// wait applies slow mode. A message it allows takes the user's slot
+// straight away, so concurrent sends cannot both get through; release gives
+// the slot back when the message is not stored after all.
+func (p *roomPolicy) wait(user *models.User, now time.Time) (release func(), err error) {
+	s := p.settings.Load()
+	if s.SlowModeSeconds <= 0 || s.CanModerate(user) {
+		return func() {}, nil
+	}
+	interval := time.Duration(s.SlowModeSeconds) * time.Second
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.prunedAt) > interval {
+		for userID, t := range p.lastPost {
+			if now.Sub(t) >= interval {
+				delete(p.lastPost, userID)
+			}
+		}
+		p.prunedAt = now
+	}
+
+	last, posted := p.lastPost[user.ID]
+	if posted {
+		if wait := interval - now.Sub(last); wait > 0 {
+			return nil, &SendError{
+				Code:       ErrCodeSlowMode,
+				Message:    fmt.Sprintf("Slow mode is on; you can post again in %d seconds", int((wait+time.Second-1)/time.Second)),
+				RetryAfter: wait,
+			}
+		}
+	}
+	p.lastPost[user.ID] = now
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !p.lastPost[user.ID].Equal(now) {
+			return
+		}
+		if posted {
+			p.lastPost[user.ID] = last
+		} else {
+			delete(p.lastPost, user.ID)
+		}
+	}, nil
+}
+
+func ruleIDs(hits []automod.Hit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Rule.ID
+	}
+	return ids
+}
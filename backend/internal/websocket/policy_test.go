@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/automod"
+	"github.com/ilhammramadhan/gabble/internal/database"
+	"github.com/ilhammramadhan/gabble/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// policyHub returns a hub with a cached policy for room "r1", so screen
+// runs without a database.
+func policyHub(settings models.RoomSettings, serverRules ...models.AutomodRule) (*Hub, *roomPolicy) {
+	h := NewHub(nil, nil, Options{})
+	h.serverAutomod.Store(automod.Compile(serverRules))
+
+	settings.RoomID = "r1"
+	settings.OwnerID = "owner"
+	p := &roomPolicy{lastPost: make(map[string]time.Time), mutes: make(map[string]time.Time)}
+	p.settings.Store(&settings)
+	p.rules.Store(automod.Compile(nil))
+	h.policies.Store("r1", p)
+	return h, p
+}
+
+// unreachableDB returns a database nothing listens for, so every query
+// fails.
+func unreachableDB(t *testing.T) *database.DB {
+	pool, err := pgxpool.New(context.Background(), "postgres://gabble@127.0.0.1:1/gabble?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &database.DB{Pool: pool}
+}
+
+func TestSlowModeRelease(t *testing.T) {
+	_, p := policyHub(models.RoomSettings{SlowModeSeconds: 30})
+	user := &models.User{ID: "u1"}
+	now := time.Now()
+
+	release, err := p.wait(user, now)
+	if err != nil {
+		t.Fatalf("first post: %v", err)
+	}
+	if _, err := p.wait(user, now.Add(time.Second)); !isSendError(err, ErrCodeSlowMode) {
+		t.Fatalf("second post: err = %v, want slow_mode", err)
+	}
+
+	// The first message was never stored, so it does not hold the slot.
+	release()
+	release2, err := p.wait(user, now.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("post after release: %v", err)
+	}
+
+	// Releasing a stale reservation leaves a newer one alone.
+	release()
+	if _, err := p.wait(user, now.Add(3*time.Second)); !isSendError(err, ErrCodeSlowMode) {
+		t.Fatalf("stale release freed the slot: err = %v", err)
+	}
+	release2()
+	if _, ok := p.lastPost[user.ID]; ok {
+		t.Error("release of a first post left a lastPost entry")
+	}
+}
+
+func TestScreenSlowModeSkipsRepeatCount(t *testing.T) {
+	h, p := policyHub(
+		models.RoomSettings{SlowModeSeconds: 30},
+		models.AutomodRule{ID: "repeat", Kind: automod.KindRepeat, Threshold: 3, Action: automod.ActionFlag},
+	)
+	user := &models.User{ID: "u1"}
+	ctx := context.Background()
+
+	if _, _, _, err := h.screen(ctx, user, "r1", "hello", "m1"); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	for _, id := range []string{"m2", "m3"} {
+		if _, _, _, err := h.screen(ctx, user, "r1", "hello", id); !isSendError(err, ErrCodeSlowMode) {
+			t.Fatalf("send %s: err = %v, want slow_mode", id, err)
+		}
+	}
+
+	// Held back messages were not counted, so this is only the second.
+	delete(p.lastPost, user.ID)
+	_, hits, _, err := h.screen(ctx, user, "r1", "hello", "m4")
+	if err != nil {
+		t.Fatalf("send after slow mode: %v", err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("repeat rule hit after two sends: %+v", hits)
+	}
+}
+
+func TestScreenRejectSkipsRepeatCount(t *testing.T) {
+	h, _ := policyHub(
+		models.RoomSettings{},
+		models.AutomodRule{ID: "repeat", Kind: automod.KindRepeat, Threshold: 2, Action: automod.ActionReject},
+	)
+	h.DB = unreachableDB(t)
+	user := &models.User{ID: "u1"}
+	ctx := context.Background()
+
+	if _, _, _, err := h.screen(ctx, user, "r1", "hello", "m1"); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if _, _, _, err := h.screen(ctx, user, "r1", "hello", "m2"); !isSendError(err, ErrCodeContentRejected) {
+		t.Fatalf("repeat: err = %v, want content_rejected", err)
+	}
+	if n, _ := h.repeats.Add(user.ID, "m3", "hello", time.Now()); n != 2 {
+		t.Errorf("count after a rejected repeat = %d, want 2", n)
+	}
+}
+
+func TestSendMessageStoreFailureSkipsRepeatCount(t *testing.T) {
+	h, p := policyHub(
+		models.RoomSettings{SlowModeSeconds: 30},
+		models.AutomodRule{ID: "repeat", Kind: automod.KindRepeat, Threshold: 5, Action: automod.ActionFlag},
+	)
+	h.DB = unreachableDB(t)
+	user := &models.User{ID: "u1"}
+
+	if _, _, err := h.SendMessage(context.Background(), user, "r1", "hello", ""); err == nil || isSendError(err, ErrCodeSlowMode) {
+		t.Fatalf("send with the database down: err = %v, want a store error", err)
+	}
+	if _, ok := p.lastPost[user.ID]; ok {
+		t.Error("failed send kept its slow mode slot")
+	}
+	if n, _ := h.repeats.Add(user.ID, "m2", "hello", time.Now()); n != 1 {
+		t.Errorf("count after a failed send = %d, want 1", n)
+	}
+}
+
+func TestScreenModeratorExempt(t *testing.T) {
+	h, _ := policyHub(models.RoomSettings{SlowModeSeconds: 30, ReadOnly: true, MaxMessageLength: 3})
+	owner := &models.User{ID: "owner"}
+
+	for i := 0; i < 3; i++ {
+		content, _, release, err := h.screen(context.Background(), owner, "r1", "a long message", "")
+		if err != nil || content != "a long message" || release == nil {
+			t.Fatalf("moderator send %d: content %q, err %v", i, content, err)
+		}
+	}
+	if _, _, _, err := h.screen(context.Background(), &models.User{ID: "u1"}, "r1", "hi", ""); !isSendError(err, ErrCodeReadOnly) {
+		t.Errorf("member send in read-only room: err = %v, want read_only", err)
+	}
+}
+
+func isSendError(err error, code string) bool {
+	var rejected *SendError
+	return errors.As(err, &rejected) && rejected.Code == code
+}
@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PollWait is how long a poll waits for events before returning none.
+	PollWait = 25 * time.Second
+	// pollSessionTTL is how long a session survives without being polled.
+	pollSessionTTL    = 60 * time.Second
+	pollSweepInterval = 5 * time.Second
+)
+
+var (
+	ErrPollInProgress = errors.New("Another poll is in progress")
+	errNotPolling     = errors.New("Client is not a long-poll session")
+)
+
+// PollTransport serves a client through long-polling. Frames wait in the
+// client's send buffer, under the usual slow consumer policy, until a poll
+// takes them. Each frame taken is numbered with a cursor and kept until a
+// later poll passes that cursor back; until then polls return the same
+// frames again, so a client that lost a response loses nothing.
+type PollTransport struct {
+	ID string
+
+	// polling is held for the duration of a poll; one runs at a time.
+	polling sync.Mutex
+	// lastPoll is when a poll last started or finished, in Unix
+	// nanoseconds.
+	lastPoll atomic.Int64
+
+	// cursor is the cursor of the newest frame taken and unacked the
+	// frames taken but not yet acknowledged. Only touched while polling.
+	cursor  int64
+	unacked [][]byte
+}
+
+type PollResponse struct {
+	// Cursor is passed to the next poll to acknowledge these events.
+	Cursor int64             `json:"cursor"`
+	Events []json.RawMessage `json:"events"`
+	// Closed is set once the session has ended, with the code and reason
+	// a WebSocket would have been closed with.
+	Closed      bool   `json:"closed,omitempty"`
+	CloseCode   int    `json:"close_code,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
+}
+
+func NewPollTransport() (*PollTransport, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	t := &PollTransport{ID: hex.EncodeToString(b)}
+	t.touch()
+	return t, nil
+}
+
+func (t *PollTransport) Name() string {
+	return "poll"
+}
+
+func (t *PollTransport) Protocol() (string, Codec) {
+	return ProtocolV1, JSON
+}
+
+// Run waits for the session to end: once its close has been polled, once
+// it goes pollSessionTTL without a poll, or, if it was closed and nobody
+// is polling, at the next sweep so Shutdown is not held up.
+func (t *PollTransport) Run(c *Client) {
+	ticker := time.NewTicker(pollSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if !t.polling.TryLock() {
+				continue
+			}
+			idle := time.Since(time.Unix(0, t.lastPoll.Load()))
+			t.polling.Unlock()
+
+			if idle > pollSessionTTL || (c.isClosed() && idle > pollSweepInterval) {
+				c.finish()
+				return
+			}
+		}
+	}
+}
+
+func (t *PollTransport) touch() {
+	t.lastPoll.Store(time.Now().UnixNano())
+}
+
+// ack discards the unacknowledged frames up to and including cursor.
+func (t *PollTransport) ack(cursor int64) {
+	first := t.cursor - int64(len(t.unacked)) + 1
+	n := cursor - first + 1
+	if n <= 0 {
+		return
+	}
+	if n > int64(len(t.unacked)) {
+		n = int64(len(t.unacked))
+	}
+	t.unacked = t.unacked[n:]
+}
+
+func (t *PollTransport) response() *PollResponse {
+	resp := &PollResponse{Cursor: t.cursor, Events: make([]json.RawMessage, len(t.unacked))}
+	for i, data := range t.unacked {
+		resp.Events[i] = data
+	}
+	return resp
+}
+
+// Poll acknowledges the events up to cursor and returns the ones after it,
+// waiting up to PollWait, or until ctx is done, for some to arrive. It
+// fails with ErrPollInProgress if the session is already being polled.
+func (c *Client) Poll(ctx context.Context, cursor int64) (*PollResponse, error) {
+	t, ok := c.transport.(*PollTransport)
+	if !ok {
+		return nil, errNotPolling
+	}
+	if !t.polling.TryLock() {
+		return nil, ErrPollInProgress
+	}
+	defer t.polling.Unlock()
+	t.touch()
+	defer t.touch()
+
+	t.ack(cursor)
+	if len(t.unacked) > 0 {
+		return t.response(), nil
+	}
+
+	timer := time.NewTimer(PollWait)
+	defer timer.Stop()
+
+	for {
+		frames, closed := c.out.take()
+		for _, f := range frames {
+			t.cursor++
+			t.unacked = append(t.unacked, f.data)
+		}
+
+		if closed {
+			resp := t.response()
+			resp.Closed = true
+			resp.CloseCode, resp.CloseReason = c.out.closeStatus()
+			c.finish()
+			return resp, nil
+		}
+		if len(frames) > 0 {
+			return t.response(), nil
+		}
+
+		select {
+		case <-c.out.ready:
+		case <-timer.C:
+			return t.response(), nil
+		case <-ctx.Done():
+			return t.response(), nil
+		}
+	}
+}
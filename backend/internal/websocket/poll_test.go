@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+func newPollClient(t *testing.T) *Client {
+	t.Helper()
+	pt, err := NewPollTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHub(nil, nil, Options{})
+	return NewClient(h, pt, &models.User{ID: "u1"})
+}
+
+func pollEvents(resp *PollResponse) []string {
+	ids := make([]string, len(resp.Events))
+	for i, raw := range resp.Events {
+		var e struct {
+			Payload MessagePayload `json:"payload"`
+		}
+		json.Unmarshal(raw, &e)
+		ids[i] = e.Payload.ID
+	}
+	return ids
+}
+
+func sendMessage(c *Client, id string) {
+	c.send(&WSMessage{Type: EventMessage, Payload: MessagePayload{ID: id}}, false)
+}
+
+func TestPollRedeliversUntilAcked(t *testing.T) {
+	c := newPollClient(t)
+	ctx := context.Background()
+	sendMessage(c, "a")
+	sendMessage(c, "b")
+
+	resp, err := c.Poll(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pollEvents(resp); len(got) != 2 || got[0] != "a" || got[1] != "b" || resp.Cursor != 2 {
+		t.Fatalf("first poll = %v cursor %d, want [a b] cursor 2", got, resp.Cursor)
+	}
+
+	// A poll that does not acknowledge gets the same events again.
+	resp, _ = c.Poll(ctx, 0)
+	if got := pollEvents(resp); len(got) != 2 {
+		t.Fatalf("unacked poll = %v, want [a b] again", got)
+	}
+
+	// Acknowledging part of them returns the rest.
+	resp, _ = c.Poll(ctx, 1)
+	if got := pollEvents(resp); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("poll after ack 1 = %v, want [b]", got)
+	}
+
+	sendMessage(c, "c")
+	resp, _ = c.Poll(ctx, 2)
+	if got := pollEvents(resp); len(got) != 1 || got[0] != "c" || resp.Cursor != 3 {
+		t.Fatalf("poll after ack 2 = %v cursor %d, want [c] cursor 3", got, resp.Cursor)
+	}
+}
+
+func TestPollWaitsForEvents(t *testing.T) {
+	c := newPollClient(t)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sendMessage(c, "late")
+	}()
+	resp, err := c.Poll(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pollEvents(resp); len(got) != 1 || got[0] != "late" {
+		t.Fatalf("poll = %v, want [late]", got)
+	}
+}
+
+func TestPollCancelled(t *testing.T) {
+	c := newPollClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	resp, err := c.Poll(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 0 || resp.Closed {
+		t.Errorf("cancelled poll = %+v, want no events", resp)
+	}
+}
+
+func TestPollInProgress(t *testing.T) {
+	c := newPollClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		c.Poll(ctx, 0)
+	}()
+	pt := c.transport.(*PollTransport)
+	eventually(t, "first poll to start", func() bool {
+		if pt.polling.TryLock() {
+			pt.polling.Unlock()
+			return false
+		}
+		return true
+	})
+
+	if _, err := c.Poll(context.Background(), 0); !errors.Is(err, ErrPollInProgress) {
+		t.Errorf("second poll err = %v, want ErrPollInProgress", err)
+	}
+	cancel()
+	<-first
+}
+
+func TestPollClosed(t *testing.T) {
+	c := newPollClient(t)
+	sendMessage(c, "last")
+	c.Close(websocket.CloseServiceRestart, "server restarting", false)
+
+	resp, err := c.Poll(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Closed || resp.CloseCode != websocket.CloseServiceRestart || resp.CloseReason != "server restarting" {
+		t.Errorf("poll = %+v, want closed with CloseServiceRestart", resp)
+	}
+	if got := pollEvents(resp); len(got) != 1 || got[0] != "last" {
+		t.Errorf("events = %v, want the frame queued before close", got)
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Error("client not finished after its close was polled")
+	}
+}
+
+func TestPollNotPolling(t *testing.T) {
+	c := NewClient(NewHub(nil, nil, Options{}), nil, &models.User{ID: "u1"})
+	if _, err := c.Poll(context.Background(), 0); err == nil {
+		t.Error("Poll on a client without a poll transport succeeded")
+	}
+}
@@ -0,0 +1,190 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+const (
+	// awayAfter is how long a connection can go without activity before it
+	// counts as idle. A user is away once all their connections are idle.
+	awayAfter = 5 * time.Minute
+	// presenceSweepInterval is how often Run looks for users gone idle.
+	presenceSweepInterval = 30 * time.Second
+)
+
+type Presence struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+	// LastSeenAt is the user's last activity when away, or when their last
+	// connection closed when offline.
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// userPresence is a user's presence across all their connections. It is
+// only touched by Run.
+type userPresence struct {
+	clients map[*Client]bool
+	status  string
+}
+
+// connect records a newly registered client. Called on the Run goroutine.
+func (h *Hub) connect(client *Client) {
+	p, ok := h.users[client.User.ID]
+	if !ok {
+		p = &userPresence{clients: make(map[*Client]bool), status: PresenceOffline}
+		h.users[client.User.ID] = p
+	}
+	p.clients[client] = true
+	h.refreshPresence(client.User.ID)
+}
+
+// disconnect forgets an unregistered client, marking its user offline and
+// saving their last seen time if it was their last connection. Called on
+// the Run goroutine.
+func (h *Hub) disconnect(client *Client) {
+	userID := client.User.ID
+	p, ok := h.users[userID]
+	if !ok {
+		return
+	}
+	delete(p.clients, client)
+	if len(p.clients) > 0 {
+		h.refreshPresence(userID)
+		return
+	}
+
+	delete(h.users, userID)
+	now := time.Now()
+	h.notifyPresence(Presence{UserID: userID, Status: PresenceOffline, LastSeenAt: &now}, client.subscriptions())
+
+	if h.DB != nil {
+		go func() {
+			if err := h.DB.UpdateLastSeen(context.Background(), userID, now); err != nil {
+				log.Printf("error saving last seen for %s: %v", userID, err)
+			}
+		}()
+	}
+}
+
+// refreshPresence recomputes a connected user's status and announces it if
+// it changed. Called on the Run goroutine.
+func (h *Hub) refreshPresence(userID string) {
+	p, ok := h.users[userID]
+	if !ok {
+		return
+	}
+
+	presence := p.current(time.Now())
+	if presence.Status == p.status {
+		return
+	}
+	p.status = presence.Status
+	h.notifyPresence(presence, p.subscriptions())
+}
+
+func (h *Hub) sweepPresence() {
+	for userID := range h.users {
+		h.refreshPresence(userID)
+	}
+}
+
+// flushLastSeen saves the last seen time of everyone still connected, for
+// when Run stops.
+func (h *Hub) flushLastSeen() {
+	if h.DB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	for userID := range h.users {
+		if err := h.DB.UpdateLastSeen(ctx, userID, now); err != nil {
+			log.Printf("error saving last seen for %s: %v", userID, err)
+		}
+	}
+}
+
+// notifyPresence sends presence_changed to each of the given rooms.
+func (h *Hub) notifyPresence(presence Presence, rooms []string) {
+	for _, roomID := range rooms {
+		h.broadcastToRoom(roomID, &WSMessage{
+			Type: EventPresenceChanged,
+			Payload: PresenceChangedPayload{
+				RoomID:   roomID,
+				Presence: presence,
+			},
+		}, "")
+	}
+}
+
+// Presence reports a user's current status. Offline users have no
+// LastSeenAt here since it lives in the database.
+func (h *Hub) Presence(userID string) Presence {
+	presence := Presence{UserID: userID, Status: PresenceOffline}
+	h.call(func() {
+		if p, ok := h.users[userID]; ok {
+			presence = p.current(time.Now())
+		}
+	})
+	return presence
+}
+
+func (p *userPresence) current(now time.Time) Presence {
+	presence := Presence{Status: PresenceAway}
+	var lastActive time.Time
+	for client := range p.clients {
+		presence.UserID = client.User.ID
+		if client.active(now) {
+			presence.Status = PresenceOnline
+		}
+		if t := client.lastActiveAt(); t.After(lastActive) {
+			lastActive = t
+		}
+	}
+	if presence.Status == PresenceAway {
+		presence.LastSeenAt = &lastActive
+	}
+	return presence
+}
+
+// subscriptions returns the rooms any of the user's connections follow.
+func (p *userPresence) subscriptions() []string {
+	seen := make(map[string]bool)
+	var rooms []string
+	for client := range p.clients {
+		for _, roomID := range client.subscriptions() {
+			if !seen[roomID] {
+				seen[roomID] = true
+				rooms = append(rooms, roomID)
+			}
+		}
+	}
+	return rooms
+}
+
+func (h *Hub) handleActivity(client *Client, msg *inbound) {
+	var payload ActivityPayload
+	if err := msg.decode(&payload); err != nil {
+		return
+	}
+
+	var changed bool
+	if payload.Idle {
+		changed = client.markIdle()
+	} else {
+		changed = client.touch()
+	}
+	if changed {
+		h.call(func() { h.refreshPresence(client.User.ID) })
+	}
+}
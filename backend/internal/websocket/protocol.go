@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"strings"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// Protocol versions. The subprotocol a client asks for is a version,
+// optionally followed by "+" and a codec name, such as "gabble.v2+msgpack";
+// without a codec frames are JSON. A client that asks for none gets
+// ProtocolV1 with JSON.
+const (
+	// ProtocolV1 is the original protocol: events may be sent straight
+	// away and hello is optional.
+	ProtocolV1 = "gabble.v1"
+	// ProtocolV2 requires the client to send hello, and wait for welcome,
+	// before anything else.
+	ProtocolV2 = "gabble.v2"
+)
+
+// Subprotocols are offered during the WebSocket handshake.
+var Subprotocols = []string{
+	ProtocolV2 + "+msgpack",
+	ProtocolV2,
+	ProtocolV1 + "+msgpack",
+	ProtocolV1,
+}
+
+// parseSubprotocol splits a negotiated subprotocol into its version and
+// codec.
+func parseSubprotocol(subprotocol string) (string, Codec) {
+	if subprotocol == "" {
+		return ProtocolV1, JSON
+	}
+	version, name, ok := strings.Cut(subprotocol, "+")
+	if !ok {
+		return version, JSON
+	}
+	if codec := codecByName(name); codec != nil {
+		return version, codec
+	}
+	return version, JSON
+}
+
+// Error codes carried in ErrorPayload.Code. Clients should branch on these
+// rather than on the human readable message.
+const (
+	// Frames that cannot be decoded are reported as "invalid_" plus the
+	// codec name.
+	ErrCodeInvalidJSON          = "invalid_json"
+	ErrCodeInvalidMsgpack       = "invalid_msgpack"
+	ErrCodeInvalidPayload       = "invalid_payload"
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeMessageTooLarge      = "message_too_large"
+	ErrCodeRateLimited          = "rate_limited"
+	ErrCodeRoomNotFound         = "room_not_found"
+	ErrCodeReadOnly             = "read_only"
+	ErrCodeMessageTooLong       = "message_too_long"
+	ErrCodeLinksNotAllowed      = "links_not_allowed"
+	ErrCodeSlowMode             = "slow_mode"
+	ErrCodeMuted                = "muted"
+	ErrCodeContentRejected      = "content_rejected"
+	ErrCodeMessageNotFound      = "message_not_found"
+	ErrCodeAlreadyReported      = "already_reported"
+	ErrCodeUnsupportedEvent     = "unsupported_event"
+	ErrCodeHandshakeRequired    = "handshake_required"
+	ErrCodeTooManySubscriptions = "too_many_subscriptions"
+	ErrCodeServerRestarting     = "server_restarting"
+	ErrCodeInternal             = "internal_error"
+)
+
+// capabilities lists the optional features this server supports, reported
+// in welcome.
+var capabilities = []string{
+	"subscriptions",
+	"presence",
+	"typing_users",
+	"acks",
+	"msgpack",
+	"reports",
+}
+
+type HelloPayload struct {
+	// Client optionally names the client application and version, for logs.
+	Client string `json:"client,omitempty"`
+}
+
+type WelcomePayload struct {
+	Protocol     string         `json:"protocol"`
+	Encoding     string         `json:"encoding"`
+	User         *models.User   `json:"user"`
+	Capabilities []string       `json:"capabilities"`
+	Limits       ProtocolLimits `json:"limits"`
+}
+
+type ProtocolLimits struct {
+	MaxMessageSize       int64 `json:"max_message_size"`
+	MaxSubscriptions     int   `json:"max_subscriptions"`
+	MaxClientMsgIDLength int   `json:"max_client_msg_id_length"`
+	SendBufferSize       int   `json:"send_buffer_size"`
+	TypingTTL            int64 `json:"typing_ttl_ms"`
+	AwayAfter            int64 `json:"away_after_ms"`
+}
+
+// handshakeRequired reports whether client must still send hello before
+// anything else.
+func (c *Client) handshakeRequired() bool {
+	return c.protocol == ProtocolV2 && !c.greeted.Load()
+}
+
+func (h *Hub) handleHello(client *Client, msg *inbound) {
+	var payload HelloPayload
+	if err := msg.decode(&payload); err != nil {
+		h.sendError(client, ErrorPayload{
+			Code:    ErrCodeInvalidPayload,
+			Message: "Invalid payload",
+			Request: EventHello,
+		})
+		return
+	}
+	client.greeted.Store(true)
+
+	client.send(&WSMessage{
+		Type: EventWelcome,
+		Payload: WelcomePayload{
+			Protocol:     client.protocol,
+			Encoding:     client.codec.Name(),
+			User:         client.User,
+			Capabilities: capabilities,
+			Limits: ProtocolLimits{
+				MaxMessageSize:       h.opts.MaxMessageSize,
+				MaxSubscriptions:     maxSubscriptions,
+				MaxClientMsgIDLength: maxClientMsgIDLength,
+				SendBufferSize:       h.opts.SendBufferSize,
+				TypingTTL:            typingTTL.Milliseconds(),
+				AwayAfter:            awayAfter.Milliseconds(),
+			},
+		},
+	}, false)
+}
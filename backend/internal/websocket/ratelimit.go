@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ilhammramadhan/gabble/internal/metrics"
+	"github.com/ilhammramadhan/gabble/internal/ratelimit"
+)
+
+var rateLimitDisconnects = metrics.NewCounter(
+	"gabble_ws_rate_limit_disconnects_total",
+	"Connections closed for sending too many rate limited events.",
+)
+
+// eventLimiters holds the hub's per-user event rate limiters.
+type eventLimiters struct {
+	byType   map[EventType]*ratelimit.Limiter
+	fallback *ratelimit.Limiter
+	abuse    *ratelimit.Limiter
+}
+
+func newEventLimiters(opts Options) eventLimiters {
+	l := eventLimiters{
+		byType:   make(map[EventType]*ratelimit.Limiter),
+		fallback: ratelimit.New("ws_event", opts.DefaultEventLimit),
+		abuse:    ratelimit.New("ws_abuse", opts.AbuseLimit),
+	}
+	for t, limit := range opts.EventLimits {
+		l.byType[t] = ratelimit.New("ws_"+string(t), limit)
+	}
+	return l
+}
+
+// AllowEvent charges userID's rate limit for an event of type t, returning
+// how long to wait when it is exhausted. HTTP endpoints that stand in for
+// WebSocket events use it so both share one budget.
+func (h *Hub) AllowEvent(userID string, t EventType) (bool, time.Duration) {
+	limiter, ok := h.limiters.byType[t]
+	if !ok {
+		limiter = h.limiters.fallback
+	}
+	return limiter.Allow(userID)
+}
+
+// allowEvent applies the rate limit for events of type t from client,
+// reporting rate_limited errors and closing the connection once the user
+// keeps going regardless.
+func (h *Hub) allowEvent(client *Client, t EventType) bool {
+	allowed, retryAfter := h.AllowEvent(client.User.ID, t)
+	if allowed {
+		return true
+	}
+
+	if ok, _ := h.limiters.abuse.Allow(client.User.ID); !ok {
+		rateLimitDisconnects.Inc()
+		client.Close(websocket.ClosePolicyViolation, "rate limit exceeded", true)
+		return false
+	}
+	h.sendError(client, ErrorPayload{
+		Code:       ErrCodeRateLimited,
+		Message:    "Too many requests, slow down",
+		Request:    t,
+		RetryAfter: retryAfter.Milliseconds() + 1,
+	})
+	return false
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+const roomMailboxSize = 256
+
+type roomCommandKind int
+
+const (
+	// cmdSubscribe adds a member that receives messages but takes no part
+	// in presence.
+	cmdSubscribe roomCommandKind = iota
+	// cmdFocus adds a member, or promotes an existing one, to the room's
+	// presence.
+	cmdFocus
+	// cmdBlur removes a member from presence but keeps it subscribed.
+	cmdBlur
+	cmdLeave
+	cmdTyping
+	cmdBroadcast
+	cmdClose
+)
+
+type roomCommand struct {
+	kind   roomCommandKind
+	client *Client
+	out    *outbound
+	typing bool
+	// senderID is the user a broadcast came from, whose typing indicator
+	// it ends. Members who blocked them do not receive it.
+	senderID string
+}
+
+// Room is the actor that owns one room's membership. Every join, leave and
+// broadcast for the room is a command in its mailbox, processed in order by
+// its own goroutine, so rooms never contend with each other.
+type Room struct {
+	ID      string
+	hub     *Hub
+	mailbox chan roomCommand
+
+	// members maps subscribed clients to whether they have the room
+	// focused. It is only touched by run.
+	members map[*Client]bool
+	// online counts each user's focused connections, so a user with several
+	// tabs appears once and only leaves when the last one does. It is only
+	// touched by run.
+	online map[string]*onlineUser
+	// size mirrors len(members) for readers outside the actor.
+	size atomic.Int64
+
+	// typing state is only touched by run; see typing.go.
+	typing      map[string]*typingUser
+	shownTyping map[string]*models.User
+	lastTyping  time.Time
+	typingTimer *time.Timer
+
+	// mu guards the hand-off between senders and the actor shutting down
+	// once the room is empty; see Hub.deliver.
+	mu      sync.Mutex
+	pending int
+	stopped bool
+}
+
+func newRoom(hub *Hub, id string) *Room {
+	return &Room{
+		ID:      id,
+		hub:     hub,
+		mailbox: make(chan roomCommand, roomMailboxSize),
+		members: make(map[*Client]bool),
+		online:  make(map[string]*onlineUser),
+
+		typing:      make(map[string]*typingUser),
+		shownTyping: make(map[string]*models.User),
+	}
+}
+
+type onlineUser struct {
+	user        *models.User
+	connections int
+}
+
+func (r *Room) run() {
+	for {
+		select {
+		case cmd := <-r.mailbox:
+			r.handle(cmd)
+		case <-r.typingDue():
+			r.updateTyping(time.Now())
+		}
+
+		if len(r.members) == 0 && r.tryStop() {
+			r.stopTypingTimer()
+			return
+		}
+	}
+}
+
+func (r *Room) handle(cmd roomCommand) {
+	switch cmd.kind {
+	case cmdSubscribe:
+		r.subscribe(cmd.client)
+	case cmdFocus:
+		r.focus(cmd.client)
+	case cmdBlur:
+		r.blur(cmd.client)
+	case cmdLeave:
+		r.leave(cmd.client)
+	case cmdTyping:
+		r.setTyping(cmd.client, cmd.typing)
+	case cmdBroadcast:
+		r.fanout(cmd.out, false, false, nil, cmd.senderID)
+		// Sending a message ends the sender's typing indicator.
+		if cmd.senderID != "" {
+			r.clearTyping(cmd.senderID)
+		}
+	case cmdClose:
+		r.close()
+	}
+}
+
+// tryStop retires an empty room unless a sender is mid-delivery or commands
+// are still queued.
+func (r *Room) tryStop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending > 0 || len(r.mailbox) > 0 {
+		return false
+	}
+	r.stopped = true
+	r.hub.rooms.CompareAndDelete(r.ID, r)
+	return true
+}
+
+func (r *Room) subscribe(client *Client) {
+	// A client unregistered while its command was queued must not be added,
+	// or nothing would ever remove it.
+	if _, ok := r.members[client]; ok || client.isClosed() {
+		return
+	}
+	r.members[client] = false
+	r.size.Store(int64(len(r.members)))
+}
+
+func (r *Room) focus(client *Client) {
+	if r.members[client] || client.isClosed() {
+		return
+	}
+	r.members[client] = true
+	r.size.Store(int64(len(r.members)))
+
+	online, ok := r.online[client.User.ID]
+	if !ok {
+		online = &onlineUser{user: client.User}
+		r.online[client.User.ID] = online
+	}
+	online.connections++
+
+	if online.connections == 1 {
+		r.emitPresence(EventUserJoined, client)
+		return
+	}
+	// The user was already here on another connection; only the new one
+	// needs the online list.
+	client.send(r.onlineUsers(), false)
+}
+
+func (r *Room) blur(client *Client) {
+	if !r.members[client] {
+		return
+	}
+	r.members[client] = false
+	r.unfocus(client)
+}
+
+func (r *Room) leave(client *Client) {
+	focused, ok := r.members[client]
+	if !ok {
+		return
+	}
+	delete(r.members, client)
+	r.size.Store(int64(len(r.members)))
+
+	if focused {
+		r.unfocus(client)
+	}
+}
+
+func (r *Room) unfocus(client *Client) {
+	online := r.online[client.User.ID]
+	if online == nil {
+		return
+	}
+	online.connections--
+	if online.connections > 0 {
+		return
+	}
+	delete(r.online, client.User.ID)
+	r.clearTyping(client.User.ID)
+	r.emitPresence(EventUserLeft, client)
+}
+
+// emitPresence tells focused members that client arrived or left, followed
+// by the new online list.
+func (r *Room) emitPresence(event EventType, client *Client) {
+	r.emit(&WSMessage{
+		Type: event,
+		Payload: UserEventPayload{
+			RoomID: r.ID,
+			User:   client.User,
+		},
+	}, true, client)
+	r.emitOnlineUsers()
+}
+
+func (r *Room) close() {
+	r.emit(&WSMessage{
+		Type:    EventRoomDeleted,
+		Payload: RoomDeletedPayload{RoomID: r.ID},
+	}, false, nil)
+
+	for client := range r.members {
+		client.unsubscribe(r.ID)
+	}
+	r.members = make(map[*Client]bool)
+	r.online = make(map[string]*onlineUser)
+	r.typing = make(map[string]*typingUser)
+	r.shownTyping = make(map[string]*models.User)
+	r.size.Store(0)
+}
+
+func (r *Room) emitOnlineUsers() {
+	r.emit(r.onlineUsers(), true, nil)
+}
+
+func (r *Room) onlineUsers() *WSMessage {
+	users := make([]*models.User, 0, len(r.online))
+	for _, online := range r.online {
+		users = append(users, online.user)
+	}
+
+	return &WSMessage{
+		Type: EventOnlineUsers,
+		Payload: OnlineUsersPayload{
+			RoomID: r.ID,
+			Users:  users,
+		},
+	}
+}
+
+func (r *Room) emit(msg *WSMessage, focusedOnly bool, exclude *Client) {
+	r.fanout(newOutbound(msg), false, focusedOnly, exclude, "")
+}
+
+// fanout queues out for every member, encoded once per codec, except
+// exclude and members who blocked from. Pushes never block, so one slow
+// member cannot stall the room; the client's outbox applies the slow
+// consumer policy instead.
+func (r *Room) fanout(out *outbound, droppable, focusedOnly bool, exclude *Client, from string) {
+	for client, focused := range r.members {
+		if client != exclude && (focused || !focusedOnly) && !client.blocks(from) {
+			client.sendOutbound(out, droppable)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRoomJoinBroadcastLeave(t *testing.T) {
+	h := newTestHub(t, Options{})
+	alice, bob := connect(h, "alice"), connect(h, "bob")
+
+	join(h, alice, "r1")
+	expectEvent(t, alice, EventOnlineUsers, nil)
+	join(h, bob, "r1")
+
+	var joined UserEventPayload
+	expectEvent(t, alice, EventUserJoined, &joined)
+	if joined.User.ID != "bob" {
+		t.Errorf("user_joined for %q, want bob", joined.User.ID)
+	}
+	var online OnlineUsersPayload
+	expectEvent(t, bob, EventOnlineUsers, &online)
+	if len(online.Users) != 2 {
+		t.Errorf("online_users has %d users, want 2", len(online.Users))
+	}
+
+	h.Broadcast("r1", &WSMessage{Type: EventMessage, Payload: MessagePayload{ID: "m1", RoomID: "r1", Content: "hi"}})
+	for _, c := range []*Client{alice, bob} {
+		var msg MessagePayload
+		expectEvent(t, c, EventMessage, &msg)
+		if msg.ID != "m1" {
+			t.Errorf("%s got message %q, want m1", c.User.ID, msg.ID)
+		}
+	}
+
+	h.Unregister <- bob
+	var left UserEventPayload
+	expectEvent(t, alice, EventUserLeft, &left)
+	if left.User.ID != "bob" {
+		t.Errorf("user_left for %q, want bob", left.User.ID)
+	}
+}
+
+func TestRoomSameUserTwoConnections(t *testing.T) {
+	h := newTestHub(t, Options{})
+	watcher := connect(h, "watcher")
+	join(h, watcher, "r1")
+	expectEvent(t, watcher, EventOnlineUsers, nil)
+
+	tab1, tab2 := connect(h, "u1"), connect(h, "u1")
+	join(h, tab1, "r1")
+	expectEvent(t, watcher, EventUserJoined, nil)
+	join(h, tab2, "r1")
+	expectEvent(t, tab2, EventOnlineUsers, nil)
+
+	// Closing one tab keeps the user online.
+	h.Unregister <- tab1
+	h.Broadcast("r1", &WSMessage{Type: EventMessage, Payload: MessagePayload{ID: "marker"}})
+	eventually(t, "marker", func() bool {
+		for _, e := range events(watcher) {
+			if e.Type == EventUserLeft {
+				t.Fatal("user_left sent while the user still had a connection")
+			}
+			if e.Type == EventMessage {
+				return true
+			}
+		}
+		return false
+	})
+
+	h.Unregister <- tab2
+	expectEvent(t, watcher, EventUserLeft, nil)
+}
+
+func TestRoomRetiresWhenEmpty(t *testing.T) {
+	h := newTestHub(t, Options{})
+	c := connect(h, "u1")
+
+	join(h, c, "r1")
+	expectEvent(t, c, EventOnlineUsers, nil)
+	if roomCount(h) != 1 {
+		t.Fatalf("rooms = %d, want 1", roomCount(h))
+	}
+
+	h.Unregister <- c
+	eventually(t, "room to retire", func() bool { return roomCount(h) == 0 })
+
+	// Commands for a retired room are dropped rather than reviving it.
+	h.Broadcast("r1", &WSMessage{Type: EventMessage})
+	if roomCount(h) != 0 {
+		t.Error("broadcast revived an empty room")
+	}
+}
+
+// TestRoomRetireHandshake races joins against the room retiring: a join
+// must either reach the old actor before it stops or start a new one, never
+// land in a mailbox nobody reads.
+func TestRoomRetireHandshake(t *testing.T) {
+	h := newTestHub(t, Options{})
+
+	for i := 0; i < 200; i++ {
+		roomID := fmt.Sprintf("r%d", i)
+		leaver, joiner := connect(h, "leaver"), connect(h, "joiner")
+		join(h, leaver, roomID)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			h.Unregister <- leaver
+		}()
+		go func() {
+			defer wg.Done()
+			join(h, joiner, roomID)
+		}()
+		wg.Wait()
+
+		h.Broadcast(roomID, &WSMessage{Type: EventMessage, Payload: MessagePayload{ID: roomID}})
+		var msg MessagePayload
+		expectEvent(t, joiner, EventMessage, &msg)
+		if msg.ID != roomID {
+			t.Fatalf("joiner got message %q, want %q", msg.ID, roomID)
+		}
+		h.Unregister <- joiner
+	}
+	eventually(t, "rooms to retire", func() bool { return roomCount(h) == 0 })
+}
+
+func TestRoomConcurrentMembership(t *testing.T) {
+	h := newTestHub(t, Options{SendBufferSize: 4096, SlowConsumerPolicy: PolicyDropOldest})
+
+	const clients = 50
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := connect(h, fmt.Sprintf("u%d", i))
+			for j := 0; j < 20; j++ {
+				roomID := fmt.Sprintf("r%d", (i+j)%5)
+				join(h, c, roomID)
+				h.Broadcast(roomID, &WSMessage{Type: EventMessage})
+				h.deliver(roomID, roomCommand{kind: cmdTyping, client: c, typing: j%2 == 0}, false)
+			}
+			h.Unregister <- c
+		}(i)
+	}
+	wg.Wait()
+
+	eventually(t, "rooms to retire", func() bool { return roomCount(h) == 0 })
+	if stats := h.ConnectionStats(); stats.Total != 0 {
+		t.Errorf("connections = %d after everyone left, want 0", stats.Total)
+	}
+}
+
+func TestCloseRoom(t *testing.T) {
+	h := newTestHub(t, Options{})
+	c := connect(h, "u1")
+	join(h, c, "r1")
+
+	h.CloseRoom("r1")
+	var deleted RoomDeletedPayload
+	expectEvent(t, c, EventRoomDeleted, &deleted)
+	if deleted.RoomID != "r1" {
+		t.Errorf("room_deleted for %q, want r1", deleted.RoomID)
+	}
+	if subs := c.subscriptions(); len(subs) != 0 {
+		t.Errorf("client still subscribed to %v", subs)
+	}
+	eventually(t, "room to retire", func() bool { return roomCount(h) == 0 })
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// restartReconnectDelay is the base reconnect delay suggested to clients
+// when the server shuts down. Each client is told a value between it and
+// twice it.
+const restartReconnectDelay = 2 * time.Second
+
+// Shutdown drains the hub for a server restart. It stops accepting new
+// clients and joins, tells every connected client to reconnect later with a
+// server_restarting event, closes each socket with CloseGoingAway once its
+// queued frames are written, and then stops Run. It returns ctx.Err() if
+// ctx expires before every client has been flushed; Run is stopped either
+// way.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	if !h.shuttingDown.CompareAndSwap(false, true) {
+		select {
+		case <-h.stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var clients []*Client
+	h.call(func() {
+		for client := range h.clients {
+			clients = append(clients, client)
+		}
+	})
+
+	for _, client := range clients {
+		delay := restartReconnectDelay + time.Duration(rand.Int63n(int64(restartReconnectDelay)))
+		client.send(&WSMessage{
+			Type:    EventServerRestarting,
+			Payload: ServerRestartingPayload{ReconnectAfter: delay.Milliseconds()},
+		}, false)
+		client.Close(websocket.CloseGoingAway, "server restarting", false)
+	}
+
+	var err error
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	close(h.quit)
+	<-h.stopped
+	return err
+}
@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseReplayLimit caps how many missed messages a resuming SSE client is
+// sent before live events.
+const sseReplayLimit = 500
+
+// SSETransport streams a client's events as Server-Sent Events until the
+// request's context is done or the client is closed. It is one-way: the
+// client sends over REST. The client must be attached and subscribed to its
+// rooms before Run.
+//
+// Each event's data is the same JSON envelope a WebSocket client receives.
+// Chat messages carry their seq as the event ID, so a client reconnecting
+// with Last-Event-ID is first sent the messages it missed, up to
+// sseReplayLimit; other events are not replayed.
+type SSETransport struct {
+	ctx         context.Context
+	w           http.ResponseWriter
+	lastEventID int64
+}
+
+func NewSSETransport(ctx context.Context, w http.ResponseWriter, lastEventID int64) *SSETransport {
+	return &SSETransport{ctx: ctx, w: w, lastEventID: lastEventID}
+}
+
+func (t *SSETransport) Name() string {
+	return "sse"
+}
+
+func (t *SSETransport) Protocol() (string, Codec) {
+	return ProtocolV1, JSON
+}
+
+func (t *SSETransport) Run(c *Client) {
+	defer c.finish()
+
+	ctx, w, lastEventID := t.ctx, t.w, t.lastEventID
+	opts := c.Hub.opts
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx and similar proxies from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	// lastSeq is the newest message written, so live copies of replayed
+	// messages are skipped.
+	lastSeq := lastEventID
+	if lastEventID > 0 && c.Hub.DB != nil {
+		messages, err := c.Hub.DB.GetMessagesAfter(ctx, c.subscriptions(), c.User.ID, lastEventID, sseReplayLimit)
+		if err != nil {
+			log.Printf("error replaying messages: %v", err)
+		}
+		for _, m := range messages {
+			data, err := JSON.Marshal(&WSMessage{
+				Type: EventMessage,
+				Payload: MessagePayload{
+					ID:          m.ID,
+					RoomID:      m.RoomID,
+					Seq:         m.Seq,
+					ClientMsgID: m.ClientMsgID,
+					Content:     m.Content,
+					User:        m.User,
+					CreatedAt:   m.CreatedAt,
+				},
+			})
+			if err != nil {
+				continue
+			}
+			rc.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", m.Seq, data); err != nil {
+				return
+			}
+			lastSeq = m.Seq
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	// Comments keep proxies from timing out an idle stream.
+	ticker := time.NewTicker(opts.pingPeriod())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-c.out.ready:
+			frames, closed := c.out.take()
+			rc.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			for _, f := range frames {
+				seq := f.seq
+				if seq > 0 && seq <= lastSeq {
+					continue
+				}
+				var err error
+				if seq > 0 {
+					lastSeq = seq
+					_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", seq, f.data)
+				} else {
+					_, err = fmt.Fprintf(w, "data: %s\n\n", f.data)
+				}
+				if err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil || closed {
+				return
+			}
+
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// messageSeq returns the seq of a chat message, or 0 for any other event.
+func messageSeq(msg *WSMessage) int64 {
+	if payload, ok := msg.Payload.(MessagePayload); ok && msg.Type == EventMessage {
+		return payload.Seq
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestFramesCarryMessageSeq(t *testing.T) {
+	h := newTestHub(t, Options{})
+	alice := connect(h, "alice")
+	join(h, alice, "r1")
+	expectEvent(t, alice, EventOnlineUsers, nil)
+
+	h.Broadcast("r1", &WSMessage{Type: EventMessage, Payload: MessagePayload{ID: "m1", RoomID: "r1", Seq: 7}})
+	h.Broadcast("r1", &WSMessage{Type: EventMessageDeleted, Payload: MessageDeletedPayload{RoomID: "r1"}})
+	alice.send(&WSMessage{Type: EventMessage, Payload: MessagePayload{ID: "m2", RoomID: "r1", Seq: 8}}, false)
+
+	var seqs []int64
+	eventually(t, "three frames", func() bool {
+		frames, _ := alice.out.take()
+		for _, f := range frames {
+			seqs = append(seqs, f.seq)
+		}
+		return len(seqs) >= 3
+	})
+	// Broadcasts go through the room, so they may land after the direct send.
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	if len(seqs) != 3 || seqs[0] != 0 || seqs[1] != 7 || seqs[2] != 8 {
+		t.Errorf("frame seqs = %v, want 0, 7 and 8", seqs)
+	}
+}
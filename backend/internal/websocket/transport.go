@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries a Client's frames between the hub and the remote end.
+// Rooms, presence and typing only see the Client, so every transport takes
+// part in them the same way.
+type Transport interface {
+	// Name identifies the transport in ConnectionStats.
+	Name() string
+	// Protocol returns the negotiated protocol version and codec.
+	Protocol() (string, Codec)
+	// Run delivers the client's queued frames, and for two-way transports
+	// reads its events, until the connection ends. It must call finish once
+	// the close has been delivered.
+	Run(c *Client)
+}
+
+// WebSocketTransport serves a client over a WebSocket connection.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+}
+
+func NewWebSocketTransport(conn *websocket.Conn) *WebSocketTransport {
+	return &WebSocketTransport{conn: conn}
+}
+
+func (t *WebSocketTransport) Name() string {
+	return "websocket"
+}
+
+func (t *WebSocketTransport) Protocol() (string, Codec) {
+	return parseSubprotocol(t.conn.Subprotocol())
+}
+
+func (t *WebSocketTransport) Run(c *Client) {
+	go t.writePump(c)
+	t.readPump(c)
+}
+
+func (t *WebSocketTransport) readPump(c *Client) {
+	defer t.conn.Close()
+
+	opts := c.Hub.opts
+	t.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	t.conn.SetPongHandler(func(string) error {
+		t.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+		return nil
+	})
+
+	for {
+		_, r, err := t.conn.NextReader()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			break
+		}
+
+		// Read one byte past the limit to tell an oversized frame from one
+		// exactly at it, without buffering the rest.
+		message, err := io.ReadAll(io.LimitReader(r, opts.MaxMessageSize+1))
+		if err != nil {
+			break
+		}
+		if int64(len(message)) > opts.MaxMessageSize {
+			t.rejectOversized(c)
+			break
+		}
+
+		c.Hub.HandleMessage(c, message)
+	}
+}
+
+// rejectOversized tells the client its frame was too large and closes the
+// connection with CloseMessageTooBig, waiting for writePump to send both
+// before readPump tears the connection down.
+func (t *WebSocketTransport) rejectOversized(c *Client) {
+	opts := c.Hub.opts
+	c.Hub.sendError(c, ErrorPayload{
+		Code:    ErrCodeMessageTooLarge,
+		Message: fmt.Sprintf("Messages are limited to %d bytes", opts.MaxMessageSize),
+	})
+	c.Close(websocket.CloseMessageTooBig, "message too large", false)
+
+	select {
+	case <-c.done:
+	case <-time.After(opts.WriteWait):
+	}
+}
+
+func (t *WebSocketTransport) writePump(c *Client) {
+	opts := c.Hub.opts
+	ticker := time.NewTicker(opts.pingPeriod())
+	defer func() {
+		ticker.Stop()
+		t.conn.Close()
+		c.finish()
+	}()
+
+	for {
+		select {
+		case <-c.out.ready:
+			frames, closed := c.out.take()
+			for _, f := range frames {
+				t.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+				// Only has an effect if the client negotiated
+				// permessage-deflate.
+				t.conn.EnableWriteCompression(len(f.data) >= opts.CompressionThreshold)
+				w, err := t.conn.NextWriter(c.codec.FrameType())
+				if err != nil {
+					return
+				}
+				w.Write(f.data)
+
+				if err := w.Close(); err != nil {
+					return
+				}
+			}
+
+			if closed {
+				t.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+				t.conn.WriteMessage(websocket.CloseMessage, c.out.closeMessage())
+				return
+			}
+		case <-ticker.C:
+			t.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := t.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
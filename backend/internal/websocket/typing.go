@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+const (
+	// typingTTL is how long a typing indicator lasts without being renewed
+	// by another typing event, so a crashed tab cannot leave it on forever.
+	typingTTL = 6 * time.Second
+	// typingFlushInterval is the least time between two typing updates sent
+	// to a room. Changes in between are coalesced, so a user toggling
+	// rapidly costs the room at most one update per interval.
+	typingFlushInterval = 500 * time.Millisecond
+)
+
+type typingUser struct {
+	user    *models.User
+	expires time.Time
+}
+
+// setTyping records a typing event from a focused member.
+func (r *Room) setTyping(client *Client, isTyping bool) {
+	if !r.members[client] {
+		return
+	}
+
+	userID := client.User.ID
+	if isTyping {
+		r.typing[userID] = &typingUser{user: client.User, expires: time.Now().Add(typingTTL)}
+	} else {
+		delete(r.typing, userID)
+	}
+	r.updateTyping(time.Now())
+}
+
+func (r *Room) clearTyping(userID string) {
+	if _, ok := r.typing[userID]; !ok {
+		return
+	}
+	delete(r.typing, userID)
+	r.updateTyping(time.Now())
+}
+
+// updateTyping expires stale indicators, sends the room an update if the
+// set of typing users changed and the flush interval allows, and arms the
+// timer for whatever is due next.
+func (r *Room) updateTyping(now time.Time) {
+	var next time.Time
+	for userID, t := range r.typing {
+		if !now.Before(t.expires) {
+			delete(r.typing, userID)
+			continue
+		}
+		if next.IsZero() || t.expires.Before(next) {
+			next = t.expires
+		}
+	}
+
+	if r.typingChanged() {
+		if flushAt := r.lastTyping.Add(typingFlushInterval); now.Before(flushAt) {
+			if next.IsZero() || flushAt.Before(next) {
+				next = flushAt
+			}
+		} else {
+			r.flushTyping(now)
+		}
+	}
+
+	r.stopTypingTimer()
+	if !next.IsZero() {
+		r.typingTimer = time.NewTimer(next.Sub(now))
+	}
+}
+
+func (r *Room) typingChanged() bool {
+	if len(r.typing) != len(r.shownTyping) {
+		return true
+	}
+	for userID := range r.typing {
+		if _, ok := r.shownTyping[userID]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flushTyping tells focused members who started and stopped typing since
+// the last flush, then sends the consolidated list.
+func (r *Room) flushTyping(now time.Time) {
+	for userID, t := range r.typing {
+		if _, ok := r.shownTyping[userID]; !ok {
+			r.emitTyping(&WSMessage{
+				Type:    EventTyping,
+				Payload: TypingEventPayload{RoomID: r.ID, User: t.user, IsTyping: true},
+			}, userID)
+		}
+	}
+	for userID, user := range r.shownTyping {
+		if _, ok := r.typing[userID]; !ok {
+			r.emitTyping(&WSMessage{
+				Type:    EventTyping,
+				Payload: TypingEventPayload{RoomID: r.ID, User: user, IsTyping: false},
+			}, userID)
+		}
+	}
+
+	r.shownTyping = make(map[string]*models.User, len(r.typing))
+	users := make([]*models.User, 0, len(r.typing))
+	for userID, t := range r.typing {
+		r.shownTyping[userID] = t.user
+		users = append(users, t.user)
+	}
+	r.emitTypingUsers(users)
+	r.lastTyping = now
+}
+
+// emitTyping sends msg, about userID, to focused members who have not
+// blocked them. Typing updates are droppable under PolicyDropTyping.
+func (r *Room) emitTyping(msg *WSMessage, userID string) {
+	r.fanout(newOutbound(msg), true, true, nil, userID)
+}
+
+// emitTypingUsers sends the typing list to focused members, leaving out
+// the users each has blocked.
+func (r *Room) emitTypingUsers(users []*models.User) {
+	out := newOutbound(&WSMessage{
+		Type:    EventTypingUsers,
+		Payload: TypingUsersPayload{RoomID: r.ID, Users: users},
+	})
+	for client, focused := range r.members {
+		if !focused {
+			continue
+		}
+		if visible := client.visible(users); len(visible) != len(users) {
+			client.sendOutbound(newOutbound(&WSMessage{
+				Type:    EventTypingUsers,
+				Payload: TypingUsersPayload{RoomID: r.ID, Users: visible},
+			}), true)
+			continue
+		}
+		client.sendOutbound(out, true)
+	}
+}
+
+// typingDue returns the typing timer's channel, or nil (which blocks
+// forever in a select) when nothing is scheduled.
+func (r *Room) typingDue() <-chan time.Time {
+	if r.typingTimer == nil {
+		return nil
+	}
+	return r.typingTimer.C
+}
+
+func (r *Room) stopTypingTimer() {
+	if r.typingTimer != nil {
+		r.typingTimer.Stop()
+		r.typingTimer = nil
+	}
+}
@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ilhammramadhan/gabble/internal/models"
+)
+
+// typingRoom returns an unstarted room with two focused members, driven
+// directly so the test controls the clock.
+func typingRoom(t *testing.T) (r *Room, alice, bob *Client) {
+	t.Helper()
+	h := NewHub(nil, nil, Options{})
+	r = newRoom(h, "r1")
+	alice = NewClient(h, nil, &models.User{ID: "alice"})
+	bob = NewClient(h, nil, &models.User{ID: "bob"})
+	r.focus(alice)
+	r.focus(bob)
+	events(alice)
+	events(bob)
+	t.Cleanup(r.stopTypingTimer)
+	return r, alice, bob
+}
+
+func typingUsers(t *testing.T, c *Client) (lists [][]string) {
+	t.Helper()
+	for _, e := range events(c) {
+		if e.Type != EventTypingUsers {
+			continue
+		}
+		var p TypingUsersPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, u := range p.Users {
+			ids = append(ids, u.ID)
+		}
+		lists = append(lists, ids)
+	}
+	return lists
+}
+
+func TestTypingFlushesFirstChangeImmediately(t *testing.T) {
+	r, alice, bob := typingRoom(t)
+
+	r.setTyping(alice, true)
+	got := typingUsers(t, bob)
+	if len(got) != 1 || len(got[0]) != 1 || got[0][0] != "alice" {
+		t.Fatalf("typing_users = %v, want [[alice]]", got)
+	}
+}
+
+func TestTypingCoalescesWithinInterval(t *testing.T) {
+	r, alice, bob := typingRoom(t)
+
+	r.setTyping(alice, true)
+	events(alice)
+	events(bob)
+
+	// Rapid toggles inside the flush interval send nothing.
+	r.setTyping(alice, false)
+	r.setTyping(alice, true)
+	r.setTyping(bob, true)
+	if got := typingUsers(t, alice); len(got) != 0 {
+		t.Fatalf("typing_users sent within the flush interval: %v", got)
+	}
+	if r.typingTimer == nil {
+		t.Fatal("no flush scheduled for the pending change")
+	}
+
+	// The pending change goes out once the interval has passed.
+	r.updateTyping(r.lastTyping.Add(typingFlushInterval))
+	got := typingUsers(t, alice)
+	if len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("typing_users after interval = %v, want both users", got)
+	}
+}
+
+func TestTypingNoChangeSendsNothing(t *testing.T) {
+	r, alice, bob := typingRoom(t)
+
+	r.setTyping(alice, true)
+	typingUsers(t, bob)
+
+	r.updateTyping(time.Now().Add(typingFlushInterval))
+	r.setTyping(alice, true)
+	if got := typingUsers(t, bob); len(got) != 0 {
+		t.Errorf("renewing an indicator sent %v", got)
+	}
+}
+
+func TestTypingExpires(t *testing.T) {
+	r, alice, bob := typingRoom(t)
+
+	r.setTyping(alice, true)
+	typingUsers(t, bob)
+
+	r.updateTyping(time.Now().Add(typingTTL))
+	got := typingUsers(t, bob)
+	if len(got) != 1 || len(got[0]) != 0 {
+		t.Fatalf("typing_users after TTL = %v, want [[]]", got)
+	}
+	if r.typingTimer != nil {
+		t.Error("typing timer still armed with nobody typing")
+	}
+}
+
+func TestTypingIgnoresUnfocused(t *testing.T) {
+	r, alice, _ := typingRoom(t)
+	r.blur(alice)
+
+	r.setTyping(alice, true)
+	if len(r.typing) != 0 {
+		t.Error("unfocused member recorded as typing")
+	}
+}